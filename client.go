@@ -1,6 +1,11 @@
 package dockercli
 
 import (
+	"io"
+	"os"
+
+	docker_cli_command "github.com/docker/docker/cli/command"
+	docker_cli_flags "github.com/docker/docker/cli/flags"
 	docker_client "github.com/docker/docker/client"
 )
 
@@ -8,3 +13,10 @@ func DefaultClient() (*docker_client.Client, error) {
 	c, err := docker_client.NewEnvClient()
 	return c, err
 }
+
+// DefaultDockerCli builds a DockerCli configured from the environment, writing its output to the passed writers
+func DefaultDockerCli(out, err io.Writer) (*docker_cli_command.DockerCli, error) {
+	cli := docker_cli_command.NewDockerCli(os.Stdin, out, err)
+	initErr := cli.Initialize(docker_cli_flags.NewClientOptions())
+	return cli, initErr
+}
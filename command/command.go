@@ -1,5 +1,9 @@
 package command
 
+import (
+	"github.com/CoachApplication/command"
+)
+
 /**
  * Run commands against a list of services
  */
@@ -9,6 +13,6 @@ type Source interface {
 }
 
 type Provider interface {
-	Get(id string) (Command, error)
+	Get(id string) (command.Command, error)
 	Order() []string
 }
@@ -0,0 +1,263 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/CoachApplication/api"
+	"github.com/CoachApplication/base"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+/**
+ * Commands are run in the containers of the running tasks of a service,
+ * like "docker exec". Exec goes through the daemon that the client talks
+ * to, so only containers on that daemon's node can be reached: matched
+ * containers on other nodes are left out, and a match with only such
+ * containers fails, naming the tasks and the nodes that they run on.
+ */
+
+// ExecClient is the part of the Docker API that running commands in service containers uses
+type ExecClient interface {
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	Info(ctx context.Context) (types.Info, error)
+
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecConfig) (types.HijackedResponse, error)
+	ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+}
+
+var _ ExecClient = client.APIClient(nil)
+
+type execOptions struct {
+	service string
+	cmd     []string
+	user    string
+	env     []string
+	all     bool
+	detach  bool
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts execOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	serviceProp := &ServiceProperty{}
+	serviceProp.Set(opts.service)
+	props.Add(serviceProp.Property())
+
+	cmdProp := &CmdProperty{}
+	cmdProp.Set(opts.cmd)
+	props.Add(cmdProp.Property())
+
+	userProp := &UserProperty{}
+	userProp.Set(opts.user)
+	props.Add(userProp.Property())
+
+	envProp := &EnvProperty{}
+	envProp.Set(opts.env)
+	props.Add(envProp.Property())
+
+	allProp := &AllProperty{}
+	allProp.Set(opts.all)
+	props.Add(allProp.Property())
+
+	detachProp := &DetachProperty{}
+	detachProp.Set(opts.detach)
+	props.Add(detachProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts execOptions) withProperties(props api.Properties) execOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_COMMAND_SERVICE); ok {
+		opts.service = val
+	}
+	if val, ok := propertyStrings(props, PROPERTY_ID_COMMAND_CMD); ok {
+		opts.cmd = val
+	}
+	if val, ok := propertyString(props, PROPERTY_ID_COMMAND_USER); ok {
+		opts.user = val
+	}
+	if val, ok := propertyStrings(props, PROPERTY_ID_COMMAND_ENV); ok {
+		opts.env = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_COMMAND_ALL); ok {
+		opts.all = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_COMMAND_DETACH); ok {
+		opts.detach = val
+	}
+	return opts
+}
+
+// validate checks that the options name a service and a command
+func (opts execOptions) validate() []error {
+	errs := []error{}
+	if opts.service == "" {
+		errs = append(errs, fmt.Errorf("No service was given to run the command in"))
+	}
+	if len(opts.cmd) == 0 {
+		errs = append(errs, fmt.Errorf("No command was given to run"))
+	}
+	return errs
+}
+
+// ContainerExecResult is the outcome of running a command in a single service container
+type ContainerExecResult struct {
+	ServiceId   string   `json:"serviceId"`
+	ContainerId string   `json:"containerId"`
+	Aliases     []string `json:"aliases"`
+	Detached    bool     `json:"detached,omitempty"`
+	ExitCode    int      `json:"exitCode"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// getServiceContainers matches the running containers on the local node of a service, or of a single task of a service, as resolved by serviceContainerMatch_FromString
+func getServiceContainers(ctx context.Context, client ExecClient, id string) (ServiceContainerMatch, error) {
+	services, err := client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := filters.NewArgs()
+	filter.Add("desired-state", string(swarm.TaskStateRunning))
+	tasks, err := client.TaskList(ctx, types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := serviceContainerMatch_FromString(id, services, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return localServiceContainers(id, match, info.Swarm.NodeID)
+}
+
+// runExec runs a command in the first matched container, or in all of them one after the other, streaming the output to stdout and stderr
+func runExec(ctx context.Context, client ExecClient, match ServiceContainerMatch, opts execOptions, stdout, stderr io.Writer) []ContainerExecResult {
+	containerIds := match.ContainerIds()
+	if !opts.all && len(containerIds) > 1 {
+		containerIds = containerIds[:1]
+	}
+
+	results := []ContainerExecResult{}
+	for _, containerId := range containerIds {
+		result := ContainerExecResult{
+			ServiceId:   match.ServiceId(),
+			ContainerId: containerId,
+			Aliases:     match.Aliases(containerId),
+			Detached:    opts.detach,
+		}
+
+		// output of several containers is prefixed, so that it can be told apart
+		containerOut, containerErr := stdout, stderr
+		prefixed := []*prefixWriter{}
+		if opts.all && len(result.Aliases) > 0 {
+			prefixedOut := &prefixWriter{w: stdout, prefix: result.Aliases[0] + " | "}
+			prefixedErr := &prefixWriter{w: stderr, prefix: result.Aliases[0] + " | "}
+			containerOut, containerErr = prefixedOut, prefixedErr
+			prefixed = append(prefixed, prefixedOut, prefixedErr)
+		}
+
+		exitCode, err := execInContainer(ctx, client, containerId, opts, containerOut, containerErr)
+		for _, pw := range prefixed {
+			pw.flush()
+		}
+		result.ExitCode = exitCode
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+	return results
+}
+
+// execInContainer runs a command in a container, and provides its exit code unless it was detached
+func execInContainer(ctx context.Context, client ExecClient, containerId string, opts execOptions, stdout, stderr io.Writer) (int, error) {
+	config := types.ExecConfig{
+		User:         opts.user,
+		Env:          opts.env,
+		Cmd:          opts.cmd,
+		Detach:       opts.detach,
+		AttachStdout: !opts.detach,
+		AttachStderr: !opts.detach,
+	}
+
+	created, err := client.ContainerExecCreate(ctx, containerId, config)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.detach {
+		return 0, client.ContainerExecStart(ctx, created.ID, types.ExecStartCheck{Detach: true})
+	}
+
+	// attaching also starts the command, and the stream ends when it exits
+	resp, err := client.ContainerExecAttach(ctx, created.ID, config)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return 0, err
+	}
+
+	inspect, err := client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// prefixWriter prefixes each line written with the container it came from
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buffer []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buffer = append(pw.buffer, p...)
+	for {
+		end := bytes.IndexByte(pw.buffer, '\n')
+		if end < 0 {
+			break
+		}
+		if err := pw.writeLine(pw.buffer[:end+1]); err != nil {
+			return 0, err
+		}
+		pw.buffer = pw.buffer[end+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes out a last line that was not terminated
+func (pw *prefixWriter) flush() {
+	if len(pw.buffer) > 0 {
+		pw.writeLine(append(pw.buffer, '\n'))
+		pw.buffer = nil
+	}
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	_, err := pw.w.Write(append([]byte(pw.prefix), line...))
+	return err
+}
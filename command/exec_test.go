@@ -0,0 +1,187 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/cli/compose/convert"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// fakeExecClient runs commands in fake containers, which print a line to each stream and exit with the code set for them
+type fakeExecClient struct {
+	nodeId    string
+	services  []swarm.Service
+	tasks     []swarm.Task
+	exitCodes map[string]int
+
+	execs   map[string]string
+	started []string
+}
+
+func (fec *fakeExecClient) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	return fec.services, nil
+}
+
+func (fec *fakeExecClient) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	tasks := []swarm.Task{}
+	for _, task := range fec.tasks {
+		if options.Filters.ExactMatch("service", task.ServiceID) && options.Filters.ExactMatch("desired-state", string(task.DesiredState)) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (fec *fakeExecClient) Info(ctx context.Context) (types.Info, error) {
+	return types.Info{Swarm: swarm.Info{NodeID: fec.nodeId}}, nil
+}
+
+func (fec *fakeExecClient) ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error) {
+	if _, found := fec.exitCodes[container]; !found {
+		return types.IDResponse{}, fmt.Errorf("Error: No such container: %s", container)
+	}
+	id := fmt.Sprintf("exec%d", len(fec.execs)+1)
+	fec.execs[id] = container
+	return types.IDResponse{ID: id}, nil
+}
+
+func (fec *fakeExecClient) ContainerExecAttach(ctx context.Context, execID string, config types.ExecConfig) (types.HijackedResponse, error) {
+	fec.started = append(fec.started, fec.execs[execID])
+
+	body := &bytes.Buffer{}
+	fmt.Fprintf(stdcopy.NewStdWriter(body, stdcopy.Stdout), "%v in %s\n", config.Cmd, fec.execs[execID])
+	fmt.Fprintf(stdcopy.NewStdWriter(body, stdcopy.Stderr), "warning\n")
+
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(body)}, nil
+}
+
+func (fec *fakeExecClient) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	fec.started = append(fec.started, fec.execs[execID])
+	return nil
+}
+
+func (fec *fakeExecClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	container := fec.execs[execID]
+	return types.ContainerExecInspect{ExecID: execID, ContainerID: container, ExitCode: fec.exitCodes[container]}, nil
+}
+
+func newFakeExecClient() *fakeExecClient {
+	web := swarm.Service{ID: "service1", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "test_web", Labels: map[string]string{convert.LabelNamespace: "test"}}}}
+	running := func(id string, slot int, container, node string) swarm.Task {
+		return swarm.Task{
+			ID:           id,
+			ServiceID:    web.ID,
+			Slot:         slot,
+			NodeID:       node,
+			DesiredState: swarm.TaskStateRunning,
+			Status: swarm.TaskStatus{
+				State:           swarm.TaskStateRunning,
+				ContainerStatus: swarm.ContainerStatus{ContainerID: container},
+			},
+		}
+	}
+	return &fakeExecClient{
+		nodeId:   "node1",
+		services: []swarm.Service{web},
+		tasks: []swarm.Task{
+			running("task2", 2, "container2", "node1"),
+			running("task1", 1, "container1", "node1"),
+			{ID: "task3", ServiceID: web.ID, Slot: 3, DesiredState: swarm.TaskStateRunning, Status: swarm.TaskStatus{State: swarm.TaskStatePreparing}},
+			running("task4", 4, "container4", "node2"),
+		},
+		exitCodes: map[string]int{"container1": 0, "container2": 3, "container4": 0},
+		execs:     map[string]string{},
+	}
+}
+
+func TestGetServiceContainersMatchesRunningTasks(t *testing.T) {
+	client := newFakeExecClient()
+
+	match, err := getServiceContainers(context.Background(), client, "test_web")
+	if err != nil {
+		t.Fatalf("Unexpected match error: %s", err)
+	}
+
+	if expected := []string{"container1", "container2"}; !reflect.DeepEqual(match.ContainerIds(), expected) {
+		t.Errorf("Expected containers %v, got %v", expected, match.ContainerIds())
+	}
+	if expected := []string{"test_web.2", "task2"}; !reflect.DeepEqual(match.Aliases("container2"), expected) {
+		t.Errorf("Expected aliases %v, got %v", expected, match.Aliases("container2"))
+	}
+
+	if _, err := getServiceContainers(context.Background(), client, "test_db"); err == nil {
+		t.Error("A missing service was matched")
+	}
+}
+
+func TestGetServiceContainersOnlyMatchesLocalContainers(t *testing.T) {
+	client := newFakeExecClient()
+
+	// the task in slot 4 runs on another node
+	if match, err := getServiceContainers(context.Background(), client, "test_web"); err != nil || len(match.ContainerIds()) != 2 {
+		t.Errorf("Expected only the local containers, got %v (%v)", match, err)
+	}
+	if _, err := getServiceContainers(context.Background(), client, "test_web.4"); err == nil || !strings.Contains(err.Error(), "test_web.4 on node node2") {
+		t.Errorf("Expected an error naming the node of the remote task, got: %v", err)
+	}
+
+	client.nodeId = "node3"
+	if _, err := getServiceContainers(context.Background(), client, "test_web"); err == nil || !strings.Contains(err.Error(), "node node3") {
+		t.Errorf("Expected an error as no containers are on the local node, got: %v", err)
+	}
+}
+
+func TestRunExecInOneContainer(t *testing.T) {
+	client := newFakeExecClient()
+	match, _ := getServiceContainers(context.Background(), client, "test_web")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	results := runExec(context.Background(), client, match, execOptions{cmd: []string{"migrate"}}, stdout, stderr)
+
+	expected := []ContainerExecResult{{ServiceId: "service1", ContainerId: "container1", Aliases: []string{"test_web.1", "task1"}}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected results %#v, got %#v", expected, results)
+	}
+	if stdout.String() != "[migrate] in container1\n" || stderr.String() != "warning\n" {
+		t.Errorf("The command output was not demultiplexed: %q, %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestRunExecInAllContainers(t *testing.T) {
+	client := newFakeExecClient()
+	match, _ := getServiceContainers(context.Background(), client, "test_web")
+
+	stdout := &bytes.Buffer{}
+	results := runExec(context.Background(), client, match, execOptions{cmd: []string{"clear-cache"}, all: true}, stdout, &bytes.Buffer{})
+
+	if len(results) != 2 || results[0].ExitCode != 0 || results[1].ExitCode != 3 {
+		t.Fatalf("Expected the exit code of each container, got %#v", results)
+	}
+	if expected := "test_web.1 | [clear-cache] in container1\ntest_web.2 | [clear-cache] in container2\n"; stdout.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestRunExecDetached(t *testing.T) {
+	client := newFakeExecClient()
+	match, _ := getServiceContainers(context.Background(), client, "test_web")
+
+	results := runExec(context.Background(), client, match, execOptions{cmd: []string{"reindex"}, detach: true}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	if len(results) != 1 || !results[0].Detached || results[0].Error != "" {
+		t.Errorf("Expected a single detached command, got %#v", results)
+	}
+	if !reflect.DeepEqual(client.started, []string{"container1"}) {
+		t.Errorf("Expected the command to be started in container1, got %v", client.started)
+	}
+}
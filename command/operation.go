@@ -1,13 +1,31 @@
 package command
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/CoachApplication/api"
 	"github.com/CoachApplication/base"
 	"github.com/CoachApplication/command"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_COMMAND_RUN = "command.run"
 )
 
 type GetOperation struct {
 	command.GetOperation
+
+	provider Provider
+}
+
+func NewGetOperation(provider Provider) *GetOperation {
+	return &GetOperation{
+		provider: provider,
+	}
 }
 
 func (gop *GetOperation) Operation() api.Operation {
@@ -25,6 +43,33 @@ func (gop *GetOperation) Properties() api.Properties {
 func (gop *GetOperation) Exec(props api.Properties) api.Result {
 	res := base.NewResult()
 
+	go func(provider Provider) {
+		defer res.MarkFinished()
+
+		id, _ := propertyString(props, (&command.IdProperty{}).Id())
+		if id == "" {
+			res.AddError(fmt.Errorf("No command id was given"))
+			res.MarkFailed()
+			return
+		}
+
+		comm, err := provider.Get(id)
+		if err == nil && comm == nil {
+			err = fmt.Errorf("No command found with id: %s", id)
+		}
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		commProp := &CommandProperty{}
+		commProp.Set(comm)
+		res.AddProperty(commProp.Property())
+
+		res.MarkSucceeded()
+	}(gop.provider)
+
 	return res.Result()
 }
 
@@ -34,6 +79,12 @@ type ListOperation struct {
 	provider Provider
 }
 
+func NewListOperation(provider Provider) *ListOperation {
+	return &ListOperation{
+		provider: provider,
+	}
+}
+
 func (lo *ListOperation) Operation() api.Operation {
 	return api.Operation(lo)
 }
@@ -46,9 +97,9 @@ func (lo *ListOperation) Exec(props api.Properties) api.Result {
 	res := base.NewResult()
 
 	go func(provider Provider) {
-		idsProp := command.IdsProperty{}
+		idsProp := &command.IdsProperty{}
 		idsProp.Set(provider.Order())
-		res.AddProperty(idsProp)
+		res.AddProperty(idsProp.Property())
 
 		res.MarkSucceeded()
 		res.MarkFinished()
@@ -56,3 +107,115 @@ func (lo *ListOperation) Exec(props api.Properties) api.Result {
 
 	return res.Result()
 }
+
+type RunOperation struct {
+	handler_dockercli.ClientOperationBase
+
+	opts   execOptions
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func NewRunOperation(base handler_dockercli.ClientOperationBase) *RunOperation {
+	return &RunOperation{
+		ClientOperationBase: base,
+		opts:                execOptions{},
+		stdout:              os.Stdout,
+		stderr:              os.Stderr,
+	}
+}
+
+// SetOutput replaces where the output of the command is streamed to
+func (ro *RunOperation) SetOutput(stdout, stderr io.Writer) {
+	ro.stdout = stdout
+	ro.stderr = stderr
+}
+
+func (ro *RunOperation) Operation() api.Operation {
+	return api.Operation(ro)
+}
+
+func (ro *RunOperation) Id() string {
+	return OPERATION_ID_COMMAND_RUN
+}
+
+func (ro *RunOperation) Ui() api.Ui {
+	return base.NewUi(
+		ro.Id(),
+		"Run command",
+		"Run a command in the running containers of a service",
+		"",
+	)
+}
+
+func (ro *RunOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (ro *RunOperation) Properties() api.Properties {
+	return ro.opts.Properties()
+}
+
+func (ro *RunOperation) Validate(props api.Properties) api.Result {
+	res := base.NewResult()
+	if errs := ro.opts.withProperties(props).validate(); len(errs) > 0 {
+		res.AddErrors(errs)
+		res.MarkFailed()
+	} else {
+		res.MarkSucceeded()
+	}
+	res.MarkFinished()
+	return res.Result()
+}
+
+func (ro *RunOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+
+	go func(opts execOptions) {
+		defer res.MarkFinished()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			res.AddErrors(errs)
+			res.MarkFailed()
+			return
+		}
+
+		client, err := ro.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+		ctx := context.Background()
+
+		match, err := getServiceContainers(ctx, client, opts.service)
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		results := runExec(ctx, client, match, opts, ro.stdout, ro.stderr)
+		resultsProp := &ExecResultsProperty{}
+		resultsProp.Set(results)
+		res.AddProperty(resultsProp.Property())
+
+		failed := false
+		for _, result := range results {
+			if result.Error != "" {
+				res.AddError(fmt.Errorf("Failed to run command in container %s: %s", result.ContainerId, result.Error))
+				failed = true
+			} else if result.ExitCode != 0 {
+				res.AddError(fmt.Errorf("Command exited with code %d in container %s", result.ExitCode, result.ContainerId))
+				failed = true
+			}
+		}
+		if failed {
+			res.MarkFailed()
+		} else {
+			res.MarkSucceeded()
+		}
+	}(ro.opts.withProperties(props))
+
+	return res.Result()
+}
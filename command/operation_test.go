@@ -0,0 +1,119 @@
+package command
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CoachApplication/api"
+	"github.com/CoachApplication/base"
+	"github.com/CoachApplication/command"
+)
+
+// stubCommand is a command that only has an id
+type stubCommand struct {
+	id string
+}
+
+func (sc *stubCommand) Id() string {
+	return sc.id
+}
+
+func (sc *stubCommand) Ui() api.Ui {
+	return base.NewUi(sc.id, "", "", "")
+}
+
+func (sc *stubCommand) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (sc *stubCommand) Properties() api.Properties {
+	return base.NewProperties().Properties()
+}
+
+func (sc *stubCommand) Validate(props api.Properties) api.Result {
+	return sc.succeed()
+}
+
+func (sc *stubCommand) Exec(props api.Properties) api.Result {
+	return sc.succeed()
+}
+
+func (sc *stubCommand) succeed() api.Result {
+	res := base.NewResult()
+	res.MarkSucceeded()
+	res.MarkFinished()
+	return res.Result()
+}
+
+// stubProvider provides the commands that it was made with
+type stubProvider struct {
+	commands map[string]command.Command
+}
+
+func (sp *stubProvider) Get(id string) (command.Command, error) {
+	if comm, found := sp.commands[id]; found {
+		return comm, nil
+	}
+	return nil, fmt.Errorf("Unknown command: %s", id)
+}
+
+func (sp *stubProvider) Order() []string {
+	order := []string{}
+	for id := range sp.commands {
+		order = append(order, id)
+	}
+	return order
+}
+
+func newStubProvider(ids ...string) *stubProvider {
+	provider := &stubProvider{commands: map[string]command.Command{}}
+	for _, id := range ids {
+		provider.commands[id] = &stubCommand{id: id}
+	}
+	return provider
+}
+
+func commandIdProperties(id string) api.Properties {
+	props := base.NewProperties()
+	idProp := &command.IdProperty{}
+	idProp.Set(id)
+	props.Add(idProp.Property())
+	return props.Properties()
+}
+
+func TestGetOperationFailsWithoutAnId(t *testing.T) {
+	gop := NewGetOperation(newStubProvider("shell"))
+
+	for _, props := range []api.Properties{nil, base.NewProperties().Properties()} {
+		res := gop.Exec(props)
+		<-res.Finished()
+		if res.Success() || len(res.Errors()) == 0 {
+			t.Error("A command was retrieved without an id")
+		}
+	}
+}
+
+func TestGetOperationFailsForAnUnknownCommand(t *testing.T) {
+	res := NewGetOperation(newStubProvider("shell")).Exec(commandIdProperties("deploy"))
+	<-res.Finished()
+
+	if res.Success() || len(res.Errors()) == 0 {
+		t.Error("An unknown command was retrieved")
+	}
+}
+
+func TestGetOperationProvidesTheCommand(t *testing.T) {
+	res := NewGetOperation(newStubProvider("shell", "deploy")).Exec(commandIdProperties("deploy"))
+	<-res.Finished()
+
+	if !res.Success() {
+		t.Fatalf("Unexpected errors retrieving a command: %v", res.Errors())
+	}
+	prop, err := res.Properties().Get(PROPERTY_ID_COMMAND)
+	if err != nil {
+		t.Fatalf("The result has no command: %s", err)
+	}
+	if comm, ok := prop.Get().(command.Command); !ok || comm.Id() != "deploy" {
+		t.Errorf("Expected command deploy, got: %#v", prop.Get())
+	}
+}
@@ -0,0 +1,310 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/CoachApplication/api"
+	"github.com/CoachApplication/base"
+	"github.com/CoachApplication/base/property"
+	"github.com/CoachApplication/command"
+)
+
+const (
+	PROPERTY_ID_COMMAND             = "command.command"
+	PROPERTY_ID_COMMAND_SERVICE     = "command.service"
+	PROPERTY_ID_COMMAND_CMD         = "command.cmd"
+	PROPERTY_ID_COMMAND_USER        = "command.user"
+	PROPERTY_ID_COMMAND_ENV         = "command.env"
+	PROPERTY_ID_COMMAND_ALL         = "command.all"
+	PROPERTY_ID_COMMAND_DETACH      = "command.detach"
+	PROPERTY_ID_COMMAND_EXECRESULTS = "command.execresults"
+)
+
+// CommandProperty holds a command resolved from a Provider
+type CommandProperty struct {
+	val command.Command
+}
+
+func (cp *CommandProperty) Property() api.Property {
+	return api.Property(cp)
+}
+
+func (cp *CommandProperty) Id() string {
+	return PROPERTY_ID_COMMAND
+}
+
+func (cp *CommandProperty) Type() string {
+	return "command.Command"
+}
+
+func (cp *CommandProperty) Ui() api.Ui {
+	return base.NewUi(
+		cp.Id(),
+		"Command",
+		"A command which can be executed",
+		"",
+	)
+}
+
+func (cp *CommandProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (cp *CommandProperty) Validate() bool {
+	return cp.val != nil
+}
+
+func (cp *CommandProperty) Get() interface{} {
+	return interface{}(cp.val)
+}
+
+func (cp *CommandProperty) Set(val interface{}) error {
+	if typedVal, success := val.(command.Command); success {
+		cp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("CommandProperty expects a command.Command value")
+	}
+}
+
+// ServiceProperty is the service whose containers a command is run in
+type ServiceProperty struct {
+	property.StringProperty
+}
+
+func (sp *ServiceProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *ServiceProperty) Id() string {
+	return PROPERTY_ID_COMMAND_SERVICE
+}
+
+func (sp *ServiceProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Service",
+		"Service to run the command in, by ID, name or name within its stack, such as web; add a slot, such as web.2, to run it in a single task",
+		"",
+	)
+}
+
+func (sp *ServiceProperty) Usage() api.Usage {
+	return (&base.RequiredPropertyUsage{}).Usage()
+}
+
+// CmdProperty is the command to run, and its arguments
+type CmdProperty struct {
+	property.StringSliceProperty
+}
+
+func (cp *CmdProperty) Property() api.Property {
+	return api.Property(cp)
+}
+
+func (cp *CmdProperty) Id() string {
+	return PROPERTY_ID_COMMAND_CMD
+}
+
+func (cp *CmdProperty) Ui() api.Ui {
+	return base.NewUi(
+		cp.Id(),
+		"Command",
+		"Command to run in the service containers, followed by its arguments",
+		"",
+	)
+}
+
+func (cp *CmdProperty) Usage() api.Usage {
+	return (&base.RequiredPropertyUsage{}).Usage()
+}
+
+// UserProperty is the user that a command runs as
+type UserProperty struct {
+	property.StringProperty
+}
+
+func (up *UserProperty) Property() api.Property {
+	return api.Property(up)
+}
+
+func (up *UserProperty) Id() string {
+	return PROPERTY_ID_COMMAND_USER
+}
+
+func (up *UserProperty) Ui() api.Ui {
+	return base.NewUi(
+		up.Id(),
+		"User",
+		"User to run the command as, in the form user[:group]; the container user is used if left empty",
+		"",
+	)
+}
+
+func (up *UserProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// EnvProperty is a list of "KEY=value" environment variables that a command runs with
+type EnvProperty struct {
+	property.StringSliceProperty
+}
+
+func (ep *EnvProperty) Property() api.Property {
+	return api.Property(ep)
+}
+
+func (ep *EnvProperty) Id() string {
+	return PROPERTY_ID_COMMAND_ENV
+}
+
+func (ep *EnvProperty) Ui() api.Ui {
+	return base.NewUi(
+		ep.Id(),
+		"Environment",
+		"Environment variables such as KEY=value, added to the container environment for the command",
+		"",
+	)
+}
+
+func (ep *EnvProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// AllProperty runs a command in every running container of a service, instead of just one
+type AllProperty struct {
+	property.BooleanProperty
+}
+
+func (ap *AllProperty) Property() api.Property {
+	return api.Property(ap)
+}
+
+func (ap *AllProperty) Id() string {
+	return PROPERTY_ID_COMMAND_ALL
+}
+
+func (ap *AllProperty) Ui() api.Ui {
+	return base.NewUi(
+		ap.Id(),
+		"All containers",
+		"Run the command in every running container of the service, one after the other",
+		"",
+	)
+}
+
+func (ap *AllProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// DetachProperty starts a command without waiting for it to finish
+type DetachProperty struct {
+	property.BooleanProperty
+}
+
+func (dp *DetachProperty) Property() api.Property {
+	return api.Property(dp)
+}
+
+func (dp *DetachProperty) Id() string {
+	return PROPERTY_ID_COMMAND_DETACH
+}
+
+func (dp *DetachProperty) Ui() api.Ui {
+	return base.NewUi(
+		dp.Id(),
+		"Detach",
+		"Start the command in the background, without streaming its output or waiting for its exit code",
+		"",
+	)
+}
+
+func (dp *DetachProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// ExecResultsProperty holds the outcome of a command in each container it was run in
+type ExecResultsProperty struct {
+	val []ContainerExecResult
+}
+
+func (erp *ExecResultsProperty) Property() api.Property {
+	return api.Property(erp)
+}
+
+func (erp *ExecResultsProperty) Id() string {
+	return PROPERTY_ID_COMMAND_EXECRESULTS
+}
+
+func (erp *ExecResultsProperty) Type() string {
+	return "[]command.ContainerExecResult"
+}
+
+func (erp *ExecResultsProperty) Ui() api.Ui {
+	return base.NewUi(
+		erp.Id(),
+		"Command results",
+		"Exit code of the command in each container that it was run in",
+		"",
+	)
+}
+
+func (erp *ExecResultsProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (erp *ExecResultsProperty) Validate() bool {
+	return erp.val != nil
+}
+
+func (erp *ExecResultsProperty) Get() interface{} {
+	return interface{}(erp.val)
+}
+
+func (erp *ExecResultsProperty) Set(val interface{}) error {
+	if typedVal, success := val.([]ContainerExecResult); success {
+		erp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("ExecResultsProperty expects a []ContainerExecResult value")
+	}
+}
+
+// getProperty retrieves a property, if there are properties and it exists in them
+func getProperty(props api.Properties, id string) (api.Property, bool) {
+	if props == nil {
+		return nil, false
+	}
+	prop, err := props.Get(id)
+	return prop, err == nil && prop != nil
+}
+
+// propertyString retrieves a string value from a property, if it exists in the properties
+func propertyString(props api.Properties, id string) (string, bool) {
+	if prop, ok := getProperty(props, id); ok {
+		if val, ok := prop.Get().(string); ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// propertyStrings retrieves a string slice value from a property, if it exists in the properties
+func propertyStrings(props api.Properties, id string) ([]string, bool) {
+	if prop, ok := getProperty(props, id); ok {
+		if val, ok := prop.Get().([]string); ok {
+			return val, true
+		}
+	}
+	return []string{}, false
+}
+
+// propertyBool retrieves a bool value from a property, if it exists in the properties
+func propertyBool(props api.Properties, id string) (bool, bool) {
+	if prop, ok := getProperty(props, id); ok {
+		if val, ok := prop.Get().(bool); ok {
+			return val, true
+		}
+	}
+	return false, false
+}
@@ -1,6 +1,13 @@
 package command
 
-import "github.com/docker/docker/api/types/swarm"
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/cli/compose/convert"
+)
 
 type ServicesProvider interface {
 	Service(id string) swarm.Service
@@ -12,9 +19,185 @@ type ServiceContainerMatch interface {
 
 	ContainerIds() []string
 	Aliases(id string) []string // Match Container ID (string) using aliases ([]string) provided
+	NodeId(id string) string    // Node that a Container ID (string) runs on
+
+}
+
+// serviceContainerMatch_FromString resolves a service, or a single task of a service, to its running containers.
+//
+// The id can be a service ID or a unique prefix of one, a full service name
+// such as "mystack_web", or a name within a stack such as "web". Any of
+// these can be followed by a task alias, such as "web.2" for the task in
+// slot 2, or "agent.<node id>" for the task of a global service on a node.
+func serviceContainerMatch_FromString(id string, services []swarm.Service, tasks []swarm.Task) (ServiceContainerMatch, error) {
+	if id == "" {
+		return nil, fmt.Errorf("No service was given")
+	}
+
+	service, err := matchService(id, services)
+	if err != nil {
+		dot := strings.LastIndex(id, ".")
+		if dot < 0 {
+			return nil, err
+		}
+		// the id may instead name a task of a service
+		service, err = matchService(id[:dot], services)
+		if err != nil {
+			return nil, err
+		}
+		alias := service.Spec.Name + "." + id[dot+1:]
+
+		match := newServiceContainers(service, tasks)
+		for _, containerId := range match.ContainerIds() {
+			if match.Aliases(containerId)[0] == alias {
+				return newServiceContainers(service, tasksWithContainer(tasks, containerId)), nil
+			}
+		}
+		return nil, fmt.Errorf("Service %s has no running task %s", service.Spec.Name, id[dot+1:])
+	}
+
+	match := newServiceContainers(service, tasks)
+	if len(match.ContainerIds()) == 0 {
+		return nil, fmt.Errorf("Service %s has no running containers", service.Spec.Name)
+	}
+	return match, nil
+}
+
+// matchService finds the one service that a reference names, trying the most exact kinds of reference first
+func matchService(ref string, services []swarm.Service) (swarm.Service, error) {
+	matchers := []func(service swarm.Service) bool{
+		func(service swarm.Service) bool { return service.ID == ref },
+		func(service swarm.Service) bool { return service.Spec.Name == ref },
+		func(service swarm.Service) bool {
+			namespace, found := service.Spec.Labels[convert.LabelNamespace]
+			return found && service.Spec.Name == convert.NewNamespace(namespace).Scope(ref)
+		},
+		func(service swarm.Service) bool { return strings.HasPrefix(service.ID, ref) },
+	}
+
+	for _, matcher := range matchers {
+		matched := []swarm.Service{}
+		for _, service := range services {
+			if matcher(service) {
+				matched = append(matched, service)
+			}
+		}
+
+		switch len(matched) {
+		case 0:
+			continue
+		case 1:
+			return matched[0], nil
+		default:
+			names := []string{}
+			for _, service := range matched {
+				names = append(names, service.Spec.Name)
+			}
+			sort.Strings(names)
+			return swarm.Service{}, fmt.Errorf("%s is ambiguous, it could be any of the services: %s", ref, strings.Join(names, ", "))
+		}
+	}
+	return swarm.Service{}, fmt.Errorf("No such service: %s", ref)
+}
+
+// tasksWithContainer picks the task that runs a container
+func tasksWithContainer(tasks []swarm.Task, containerId string) []swarm.Task {
+	for _, task := range tasks {
+		if task.Status.ContainerStatus.ContainerID == containerId {
+			return []swarm.Task{task}
+		}
+	}
+	return []swarm.Task{}
+}
+
+// serviceContainers matches the containers of the running tasks of a service, in slot order
+type serviceContainers struct {
+	serviceId    string
+	containerIds []string
+	aliases      map[string][]string
+	nodeIds      map[string]string
+}
+
+// newServiceContainers matches the containers of those tasks of a service which are running
+func newServiceContainers(service swarm.Service, tasks []swarm.Task) *serviceContainers {
+	running := []swarm.Task{}
+	for _, task := range tasks {
+		if task.ServiceID == service.ID && task.Status.State == swarm.TaskStateRunning && task.Status.ContainerStatus.ContainerID != "" {
+			running = append(running, task)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		if running[i].Slot != running[j].Slot {
+			return running[i].Slot < running[j].Slot
+		}
+		return running[i].NodeID < running[j].NodeID
+	})
+
+	scm := &serviceContainers{
+		serviceId:    service.ID,
+		containerIds: []string{},
+		aliases:      map[string][]string{},
+		nodeIds:      map[string]string{},
+	}
+	for _, task := range running {
+		containerId := task.Status.ContainerStatus.ContainerID
+		scm.containerIds = append(scm.containerIds, containerId)
+		scm.aliases[containerId] = []string{taskAlias(service, task), task.ID}
+		scm.nodeIds[containerId] = task.NodeID
+	}
+	return scm
+}
+
+func (scm *serviceContainers) ServiceId() string {
+	return scm.serviceId
+}
+
+func (scm *serviceContainers) ContainerIds() []string {
+	return scm.containerIds
+}
+
+func (scm *serviceContainers) Aliases(id string) []string {
+	return scm.aliases[id]
+}
+
+func (scm *serviceContainers) NodeId(id string) string {
+	return scm.nodeIds[id]
+}
+
+// localServiceContainers narrows a match to the containers on a node, as only those can be reached through the daemon of that node
+func localServiceContainers(id string, match ServiceContainerMatch, nodeId string) (ServiceContainerMatch, error) {
+	// a daemon outside of a swarm has no node, and only sees its own containers
+	if nodeId == "" {
+		return match, nil
+	}
+
+	local := &serviceContainers{
+		serviceId:    match.ServiceId(),
+		containerIds: []string{},
+		aliases:      map[string][]string{},
+		nodeIds:      map[string]string{},
+	}
+	remote := []string{}
+	for _, containerId := range match.ContainerIds() {
+		if match.NodeId(containerId) != nodeId {
+			remote = append(remote, fmt.Sprintf("%s on node %s", match.Aliases(containerId)[0], match.NodeId(containerId)))
+			continue
+		}
+		local.containerIds = append(local.containerIds, containerId)
+		local.aliases[containerId] = match.Aliases(containerId)
+		local.nodeIds[containerId] = nodeId
+	}
 
+	if len(local.containerIds) == 0 {
+		return nil, fmt.Errorf("%s has no running containers on node %s, which the Docker client is connected to, only: %s; connect to one of those nodes to run the command", id, nodeId, strings.Join(remote, ", "))
+	}
+	return local, nil
 }
 
-func serviceContainerMatch_FromString(id string, services []swarm.Service) (ServiceContainerMatch, error) {
-	return nil, nil
+// taskAlias names a task like swarm names its container: by slot for replicated services, and by node for global services
+func taskAlias(service swarm.Service, task swarm.Task) string {
+	if task.Slot == 0 {
+		return fmt.Sprintf("%s.%s", service.Spec.Name, task.NodeID)
+	}
+	return fmt.Sprintf("%s.%d", service.Spec.Name, task.Slot)
 }
@@ -0,0 +1,101 @@
+package command
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/cli/compose/convert"
+)
+
+func testStackService(id, namespace, name string) swarm.Service {
+	return swarm.Service{
+		ID: id,
+		Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{
+			Name:   convert.NewNamespace(namespace).Scope(name),
+			Labels: map[string]string{convert.LabelNamespace: namespace},
+		}},
+	}
+}
+
+func testRunningTask(serviceID string, slot int, nodeID, containerID string) swarm.Task {
+	return swarm.Task{
+		ID:           "task" + containerID,
+		ServiceID:    serviceID,
+		Slot:         slot,
+		NodeID:       nodeID,
+		DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{
+			State:           swarm.TaskStateRunning,
+			ContainerStatus: swarm.ContainerStatus{ContainerID: containerID},
+		},
+	}
+}
+
+func TestServiceContainerMatchFromString(t *testing.T) {
+	services := []swarm.Service{
+		testStackService("abc123", "shop", "web"),
+		testStackService("abd456", "shop", "db"),
+		testStackService("xyz789", "blog", "agent"),
+	}
+	tasks := []swarm.Task{
+		testRunningTask("abc123", 1, "node1", "web1"),
+		testRunningTask("abc123", 2, "node2", "web2"),
+		testRunningTask("abd456", 1, "node1", "db1"),
+		testRunningTask("xyz789", 0, "node1", "agent1"),
+		testRunningTask("xyz789", 0, "node2", "agent2"),
+	}
+
+	matches := map[string][]string{
+		"web":          {"web1", "web2"},
+		"shop_web":     {"web1", "web2"},
+		"abc123":       {"web1", "web2"},
+		"abd":          {"db1"},
+		"web.2":        {"web2"},
+		"shop_web.1":   {"web1"},
+		"agent.node2":  {"agent2"},
+		"xyz789.node1": {"agent1"},
+	}
+	for id, expected := range matches {
+		match, err := serviceContainerMatch_FromString(id, services, tasks)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %s", id, err)
+			continue
+		}
+		if !reflect.DeepEqual(match.ContainerIds(), expected) {
+			t.Errorf("Expected %s to match containers %v, got %v", id, expected, match.ContainerIds())
+		}
+	}
+
+	match, _ := serviceContainerMatch_FromString("web.2", services, tasks)
+	if expected := []string{"shop_web.2", "taskweb2"}; !reflect.DeepEqual(match.Aliases("web2"), expected) {
+		t.Errorf("Expected aliases %v, got %v", expected, match.Aliases("web2"))
+	}
+}
+
+func TestServiceContainerMatchFromStringErrors(t *testing.T) {
+	services := []swarm.Service{
+		testStackService("abc123", "shop", "web"),
+		testStackService("abd456", "blog", "web"),
+	}
+	tasks := []swarm.Task{
+		testRunningTask("abc123", 1, "node1", "web1"),
+	}
+
+	errors := map[string]string{
+		"web":        "ambiguous",
+		"ab":         "ambiguous",
+		"cache":      "No such service",
+		"shop_web.3": "no running task",
+		"blog_web":   "no running containers",
+	}
+	for id, expected := range errors {
+		_, err := serviceContainerMatch_FromString(id, services, tasks)
+		if err == nil {
+			t.Errorf("%s was resolved", id)
+		} else if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the error for %s to mention %q, got: %s", id, expected, err)
+		}
+	}
+}
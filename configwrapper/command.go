@@ -1 +1,20 @@
 package configwrapper
+
+import (
+	"github.com/CoachApplication/api"
+	"github.com/CoachApplication/base"
+	"github.com/CoachApplication/config"
+
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+	handler_dockercli_command "github.com/CoachApplication/handler-dockercli/command"
+)
+
+func MakeCommandOperations(wr config.Wrapper) api.Operations {
+	ops := base.NewOperations()
+
+	cob := handler_dockercli.NewClientOperationBaseDefault()
+
+	ops.Add(handler_dockercli_command.NewRunOperation(*cob).Operation())
+
+	return ops.Operations()
+}
@@ -1,6 +1,8 @@
 package configwrapper
 
 import (
+	"os"
+
 	"github.com/CoachApplication/api"
 	"github.com/CoachApplication/base"
 	"github.com/CoachApplication/config"
@@ -9,13 +11,55 @@ import (
 	handler_dockercli_stack "github.com/CoachApplication/handler-dockercli/stack"
 )
 
+const (
+	// CONFIG_KEY_COMPOSE is the config which holds the compose definition of the stack
+	CONFIG_KEY_COMPOSE = "compose"
+)
+
+// MakeOrchestrateOperations provides the stack operations for the project in the current directory
 func MakeOrchestrateOperations(wr config.Wrapper) api.Operations {
+	wd, _ := os.Getwd()
+	return MakeOrchestrateOperationsForProject(wr, wd)
+}
+
+// MakeOrchestrateOperationsForProject provides the stack operations for the project in projectRoot.
+//
+// If the wrapper holds a compose config, the stack is deployed from it;
+// otherwise the compose files in projectRoot are deployed.
+func MakeOrchestrateOperationsForProject(wr config.Wrapper, projectRoot string) api.Operations {
 	ops := base.NewOperations()
 
 	cob := handler_dockercli.NewClientOperationBaseDefault()
 
-	ops.Add(handler_dockercli_stack.NewOrchestrateUpOperation(*cob).Operation())
-	ops.Add(handler_dockercli_stack.NewOrchestrateDownOperation(*cob).Operation())
+	if composeConfig, found := getComposeConfig(wr); found {
+		ops.Add(handler_dockercli_stack.NewOrchestrateUpOperationFromConfig(*cob, composeConfig, projectRoot).Operation())
+		ops.Add(handler_dockercli_stack.NewOrchestratePlanOperationFromConfig(*cob, composeConfig, projectRoot).Operation())
+	} else {
+		ops.Add(handler_dockercli_stack.NewOrchestrateUpOperationForProject(*cob, projectRoot).Operation())
+		ops.Add(handler_dockercli_stack.NewOrchestratePlanOperationForProject(*cob, projectRoot).Operation())
+	}
+	ops.Add(handler_dockercli_stack.NewOrchestrateDownOperationForProject(*cob, projectRoot).Operation())
+	ops.Add(handler_dockercli_stack.NewOrchestrateListOperation(*cob).Operation())
+	ops.Add(handler_dockercli_stack.NewOrchestratePsOperationForProject(*cob, projectRoot).Operation())
+	ops.Add(handler_dockercli_stack.NewOrchestrateLogsOperationForProject(*cob, projectRoot).Operation())
+	ops.Add(handler_dockercli_stack.NewOrchestrateScaleOperationForProject(*cob, projectRoot).Operation())
 
 	return ops.Operations()
 }
+
+// getComposeConfig retrieves the compose config from the first scope that holds it
+func getComposeConfig(wr config.Wrapper) (config.Config, bool) {
+	if wr == nil {
+		return nil, false
+	}
+	scoped, err := wr.Get(CONFIG_KEY_COMPOSE)
+	if err != nil || scoped == nil {
+		return nil, false
+	}
+	for _, scope := range scoped.Order() {
+		if composeConfig, err := scoped.Get(scope); err == nil && composeConfig != nil {
+			return composeConfig, true
+		}
+	}
+	return nil, false
+}
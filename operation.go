@@ -1,11 +1,14 @@
 package dockercli
 
 import (
+	"errors"
+
 	docker_client "github.com/docker/docker/client"
 )
 
 type ClientOperationBase struct {
 	client *docker_client.Client
+	err    error
 }
 
 func NewClientOperationBase(c *docker_client.Client) *ClientOperationBase {
@@ -14,12 +17,24 @@ func NewClientOperationBase(c *docker_client.Client) *ClientOperationBase {
 	}
 }
 func NewClientOperationBaseDefault() *ClientOperationBase {
-	c, _ := DefaultClient() // @TODO we don't catch this error, but we should
+	c, err := DefaultClient()
 	return &ClientOperationBase{
 		client: c,
+		err:    err,
 	}
 }
 
 func (cob *ClientOperationBase) DockerClient() *docker_client.Client {
 	return cob.client
 }
+
+// DockerClientOrError provides the docker client, or the error that kept it from being built
+func (cob *ClientOperationBase) DockerClientOrError() (*docker_client.Client, error) {
+	if cob.err != nil {
+		return nil, cob.err
+	}
+	if cob.client == nil {
+		return nil, errors.New("No docker client was configured for the operation")
+	}
+	return cob.client, nil
+}
@@ -0,0 +1,145 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_command_bundlefile "github.com/docker/docker/cli/command/bundlefile"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+)
+
+func loadBundlefile(events EventSink, path string) (*docker_cli_command_bundlefile.Bundlefile, error) {
+	events.Emit(Event{Kind: RESOURCE_KIND_STACK, Name: path, Action: RESOURCE_ACTION_LOAD, Status: EVENT_STATUS_INFO, Message: "Loading bundle from " + path})
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	bundle, err := docker_cli_command_bundlefile.LoadFile(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	return bundle, nil
+}
+
+/**
+ * Actual deploy
+ */
+
+func deployBundle(ctx context.Context, client StackClient, events EventSink, registryAuth registryAuthFunc, opts deployOptions) (*RollbackReport, error) {
+	bundle, err := loadBundlefile(events, opts.resolvePath(opts.bundlefile))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDaemonIsSwarmManager(ctx, client); err != nil {
+		return nil, err
+	}
+
+	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
+
+	// prune failures don't stop the deploy, but are still reported once it is done
+	errs := []error{}
+	if opts.prune {
+		services := map[string]struct{}{}
+		for service := range bundle.Services {
+			services[service] = struct{}{}
+		}
+		errs = append(errs, pruneServices(ctx, client, events, namespace, services, opts.parallelism)...)
+	}
+
+	networks := convertBundleNetworks(namespace, bundle)
+	services := convertBundleServices(namespace, bundle)
+
+	if err := createNetworks(ctx, client, events, namespace, networks); err != nil {
+		return nil, errorsOrNil(append(errs, err))
+	}
+	report, err := deployServicesWithRollback(ctx, client, events, services, nil, namespace, registryAuth, opts)
+	if err != nil {
+		return report, errorsOrNil(append(errs, err))
+	}
+	// networks dropped from the stack are pruned once the services have moved off them
+	if opts.prune {
+		errs = append(errs, pruneNetworks(ctx, client, events, namespace, networks)...)
+	}
+	return nil, errorsOrNil(errs)
+}
+
+// convertBundleNetworks collects the networks used by all bundle services
+func convertBundleNetworks(
+	namespace docker_cli_compose_convert.Namespace,
+	bundle *docker_cli_command_bundlefile.Bundlefile,
+) map[string]docker_api_types.NetworkCreate {
+	networks := make(map[string]docker_api_types.NetworkCreate)
+	for _, service := range bundle.Services {
+		for _, networkName := range service.Networks {
+			networks[networkName] = docker_api_types.NetworkCreate{
+				Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil),
+			}
+		}
+	}
+	return networks
+}
+
+// convertBundleServices converts bundle services to swarm service specs, keyed by their internal name
+func convertBundleServices(
+	namespace docker_cli_compose_convert.Namespace,
+	bundle *docker_cli_command_bundlefile.Bundlefile,
+) map[string]docker_api_types_swarm.ServiceSpec {
+	services := make(map[string]docker_api_types_swarm.ServiceSpec)
+	for internalName, service := range bundle.Services {
+		name := namespace.Scope(internalName)
+
+		var ports []docker_api_types_swarm.PortConfig
+		for _, portSpec := range service.Ports {
+			ports = append(ports, docker_api_types_swarm.PortConfig{
+				Protocol:   docker_api_types_swarm.PortConfigProtocol(portSpec.Protocol),
+				TargetPort: portSpec.Port,
+			})
+		}
+
+		nets := []docker_api_types_swarm.NetworkAttachmentConfig{}
+		for _, networkName := range service.Networks {
+			nets = append(nets, docker_api_types_swarm.NetworkAttachmentConfig{
+				Target:  namespace.Scope(networkName),
+				Aliases: []string{internalName},
+			})
+		}
+
+		containerSpec := docker_api_types_swarm.ContainerSpec{
+			Image:   service.Image,
+			Command: service.Command,
+			Args:    service.Args,
+			Env:     service.Env,
+			// Service Labels will not be copied to Containers
+			// automatically during the deployment so we apply
+			// it here.
+			Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil),
+		}
+		if service.WorkingDir != nil {
+			containerSpec.Dir = *service.WorkingDir
+		}
+		if service.User != nil {
+			containerSpec.User = *service.User
+		}
+
+		services[internalName] = docker_api_types_swarm.ServiceSpec{
+			Annotations: docker_api_types_swarm.Annotations{
+				Name:   name,
+				Labels: docker_cli_compose_convert.AddStackLabel(namespace, service.Labels),
+			},
+			TaskTemplate: docker_api_types_swarm.TaskSpec{
+				ContainerSpec: containerSpec,
+			},
+			EndpointSpec: &docker_api_types_swarm.EndpointSpec{
+				Ports: ports,
+			},
+			Networks: nets,
+		}
+	}
+	return services
+}
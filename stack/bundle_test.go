@@ -0,0 +1,98 @@
+package stack
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func writeBundlefile(t *testing.T, dir, contents string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.dab"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDeployDeploysABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeBundlefile(t, dir, `{
+  "Version": "0.1",
+  "Services": {
+    "web": {
+      "Image": "nginx@sha256:0123",
+      "Networks": ["front"],
+      "Ports": [{"Protocol": "tcp", "Port": 80}]
+    },
+    "worker": {
+      "Image": "worker@sha256:4567",
+      "Networks": ["front", "back"],
+      "User": "app"
+    }
+  }
+}`)
+
+	swarm := fakeswarm.NewSwarm()
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+	opts.bundlefile = "app.dab"
+	if _, err := runDeploy(context.Background(), swarm, &recordingEventSink{}, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	networks := map[string]string{}
+	for _, network := range swarm.Networks() {
+		networks[network.Name] = network.Labels[docker_cli_compose_convert.LabelNamespace]
+	}
+	if networks["test_front"] != "test" || networks["test_back"] != "test" {
+		t.Errorf("Expected the bundle networks to be created in the stack, got %v", networks)
+	}
+
+	web, found := swarm.Service("test_web")
+	if !found {
+		t.Fatal("The web service was not created")
+	}
+	if web.Spec.TaskTemplate.ContainerSpec.Image != "nginx@sha256:0123" || len(web.Spec.EndpointSpec.Ports) != 1 || web.Spec.EndpointSpec.Ports[0].TargetPort != 80 {
+		t.Errorf("The web service was not converted from the bundle: %#v", web.Spec)
+	}
+	if len(web.Spec.Networks) != 1 || web.Spec.Networks[0].Target != "test_front" || web.Spec.Networks[0].Aliases[0] != "web" {
+		t.Errorf("The web service was not attached to its network under its bundle name: %#v", web.Spec.Networks)
+	}
+	worker, found := swarm.Service("test_worker")
+	if !found || worker.Spec.TaskTemplate.ContainerSpec.User != "app" {
+		t.Errorf("The worker service was not converted from the bundle: %#v", worker.Spec)
+	}
+
+	// dropping the worker prunes it, and the network that only it used
+	writeBundlefile(t, dir, `{"Version": "0.1", "Services": {"web": {"Image": "nginx@sha256:0123", "Networks": ["front"]}}}`)
+	opts.prune = true
+	if _, err := runDeploy(context.Background(), swarm, &recordingEventSink{}, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	if _, found := swarm.Service("test_worker"); found {
+		t.Error("The worker service dropped from the bundle was not pruned")
+	}
+	for _, network := range swarm.Networks() {
+		if network.Name == "test_back" {
+			t.Error("The network dropped from the bundle was not pruned")
+		}
+	}
+}
+
+func TestRunDeployFailsOnAMissingBundle(t *testing.T) {
+	opts := newDeployOptionsForProject(os.TempDir())
+	opts.namespace = "test"
+	opts.bundlefile = "missing.dab"
+	if _, err := runDeploy(context.Background(), fakeswarm.NewSwarm(), &recordingEventSink{}, noRegistryAuth, opts); err == nil {
+		t.Error("A missing bundle was deployed")
+	}
+}
@@ -0,0 +1,96 @@
+package stack
+
+import (
+	"context"
+	"io"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_client "github.com/docker/docker/client"
+)
+
+// StackClient is the part of the Docker API that stack actions use.
+//
+// A docker_client.APIClient satisfies it, but keeping it narrow means that
+// the stack actions can also be run against an in-memory swarm.
+type StackClient interface {
+	ClientVersion() string
+	Info(ctx context.Context) (docker_api_types.Info, error)
+
+	ServiceList(ctx context.Context, options docker_api_types.ServiceListOptions) ([]docker_api_types_swarm.Service, error)
+	ServiceCreate(ctx context.Context, service docker_api_types_swarm.ServiceSpec, options docker_api_types.ServiceCreateOptions) (docker_api_types.ServiceCreateResponse, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version docker_api_types_swarm.Version, service docker_api_types_swarm.ServiceSpec, options docker_api_types.ServiceUpdateOptions) (docker_api_types.ServiceUpdateResponse, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+	ServiceLogs(ctx context.Context, serviceID string, options docker_api_types.ContainerLogsOptions) (io.ReadCloser, error)
+	TaskList(ctx context.Context, options docker_api_types.TaskListOptions) ([]docker_api_types_swarm.Task, error)
+	NodeList(ctx context.Context, options docker_api_types.NodeListOptions) ([]docker_api_types_swarm.Node, error)
+
+	NetworkList(ctx context.Context, options docker_api_types.NetworkListOptions) ([]docker_api_types.NetworkResource, error)
+	NetworkCreate(ctx context.Context, name string, options docker_api_types.NetworkCreate) (docker_api_types.NetworkCreateResponse, error)
+	NetworkInspect(ctx context.Context, networkID string, verbose bool) (docker_api_types.NetworkResource, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+
+	SecretList(ctx context.Context, options docker_api_types.SecretListOptions) ([]docker_api_types_swarm.Secret, error)
+	SecretCreate(ctx context.Context, secret docker_api_types_swarm.SecretSpec) (docker_api_types.SecretCreateResponse, error)
+	SecretInspectWithRaw(ctx context.Context, name string) (docker_api_types_swarm.Secret, []byte, error)
+	SecretUpdate(ctx context.Context, id string, version docker_api_types_swarm.Version, secret docker_api_types_swarm.SecretSpec) error
+	SecretRemove(ctx context.Context, id string) error
+}
+
+var _ StackClient = docker_client.APIClient(nil)
+
+// convertClient adapts a StackClient to the full client that the compose
+// converter asks for; the converter only reads the client version and
+// lists secrets, so every other method is left unimplemented.
+//
+// The converter looks secrets up by their stack name, so the current
+// version of each stack secret is listed under that name instead.
+type convertClient struct {
+	docker_client.CommonAPIClient
+	client   StackClient
+	versions map[string]string
+	planned  []docker_api_types_swarm.SecretSpec
+}
+
+func newConvertClient(client StackClient, secrets []docker_api_types_swarm.SecretSpec) convertClient {
+	return convertClient{client: client, versions: secretVersionNames(secrets)}
+}
+
+// newPlanConvertClient also lists secrets that a deploy would create, so that services can be converted before the secrets exist
+func newPlanConvertClient(client StackClient, planned []docker_api_types_swarm.SecretSpec) convertClient {
+	return convertClient{client: client, versions: secretVersionNames(planned), planned: planned}
+}
+
+func (cc convertClient) ClientVersion() string {
+	return cc.client.ClientVersion()
+}
+
+func (cc convertClient) SecretList(ctx context.Context, options docker_api_types.SecretListOptions) ([]docker_api_types_swarm.Secret, error) {
+	listed, err := cc.client.SecretList(ctx, options)
+	if err != nil {
+		return listed, err
+	}
+
+	existing := map[string]bool{}
+	for _, secret := range listed {
+		existing[secret.Spec.Name] = true
+	}
+	for _, spec := range cc.planned {
+		if !existing[spec.Name] && options.Filters.FuzzyMatch("name", spec.Name) {
+			listed = append(listed, docker_api_types_swarm.Secret{Spec: spec})
+		}
+	}
+
+	secrets := []docker_api_types_swarm.Secret{}
+	for _, secret := range listed {
+		// an unversioned secret with a stack name would hide the current version
+		if _, versioned := cc.versions[secret.Spec.Name]; versioned {
+			continue
+		}
+		if stackName, found := secret.Spec.Labels[LABEL_SECRET_NAME]; found && cc.versions[stackName] == secret.Spec.Name {
+			secret.Spec.Name = stackName
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
 	docker_api_types "github.com/docker/docker/api/types"
 	docker_api_types_filters "github.com/docker/docker/api/types/filters"
 	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
-	docker_cli_command "github.com/docker/docker/cli/command"
 	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
 	docker_client "github.com/docker/docker/client"
 	docker_opts "github.com/docker/docker/opts"
@@ -18,8 +18,8 @@ import (
 // a swarm manager. This is necessary because we must create networks before we
 // create services, but the API call for creating a network does not return a
 // proper status code when it can't create a network in the "global" scope.
-func checkDaemonIsSwarmManager(ctx context.Context, dockerCli *docker_cli_command.DockerCli) error {
-	info, err := dockerCli.Client().Info(ctx)
+func checkDaemonIsSwarmManager(ctx context.Context, client StackClient) error {
+	info, err := client.Info(ctx)
 	if err != nil {
 		return err
 	}
@@ -49,7 +49,7 @@ func getAllStacksFilter() docker_api_types_filters.Args {
 
 func getStackServices(
 	ctx context.Context,
-	apiclient docker_client.APIClient,
+	apiclient StackClient,
 	namespace string,
 ) ([]docker_api_types_swarm.Service, error) {
 	return apiclient.ServiceList(
@@ -59,7 +59,7 @@ func getStackServices(
 
 func getStackNetworks(
 	ctx context.Context,
-	apiclient docker_client.APIClient,
+	apiclient StackClient,
 	namespace string,
 ) ([]docker_api_types.NetworkResource, error) {
 	return apiclient.NetworkList(
@@ -69,7 +69,7 @@ func getStackNetworks(
 
 func getStackSecrets(
 	ctx context.Context,
-	apiclient docker_client.APIClient,
+	apiclient StackClient,
 	namespace string,
 ) ([]docker_api_types_swarm.Secret, error) {
 	return apiclient.SecretList(
@@ -77,31 +77,143 @@ func getStackSecrets(
 		docker_api_types.SecretListOptions{Filters: getStackFilter(namespace)})
 }
 
-// pruneServices removes services that are no longer referenced in the source
-func pruneServices(ctx context.Context, dockerCli docker_cli_command.Cli, namespace docker_cli_compose_convert.Namespace, services map[string]struct{}) bool {
-	client := dockerCli.Client()
+func getStackTasks(
+	ctx context.Context,
+	apiclient StackClient,
+	namespace string,
+) ([]docker_api_types_swarm.Task, error) {
+	return apiclient.TaskList(
+		ctx,
+		docker_api_types.TaskListOptions{Filters: getStackFilter(namespace)})
+}
 
+// pruneServices removes services that are no longer referenced in the source
+func pruneServices(ctx context.Context, client StackClient, events EventSink, namespace docker_cli_compose_convert.Namespace, services map[string]struct{}, parallelism int) []error {
 	oldServices, err := getStackServices(ctx, client, namespace.Name())
 	if err != nil {
-		fmt.Fprintf(dockerCli.Err(), "Failed to list services: %s", err)
-		return true
+		return []error{reportResourceError(events, RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)}
 	}
 
+	_, errs := removeServices(ctx, client, events, selectPrunedServices(namespace, oldServices, services), parallelism)
+	return errs
+}
+
+// selectPrunedServices picks the stack services that are no longer referenced in the source, sorted by name
+func selectPrunedServices(namespace docker_cli_compose_convert.Namespace, oldServices []docker_api_types_swarm.Service, services map[string]struct{}) []docker_api_types_swarm.Service {
 	pruneServices := []docker_api_types_swarm.Service{}
 	for _, service := range oldServices {
 		if _, exists := services[namespace.Descope(service.Spec.Name)]; !exists {
 			pruneServices = append(pruneServices, service)
 		}
 	}
-	return removeServices(ctx, dockerCli, pruneServices)
+	sort.Slice(pruneServices, func(i, j int) bool { return pruneServices[i].Spec.Name < pruneServices[j].Spec.Name })
+	return pruneServices
+}
+
+// pruneNetworks removes stack networks that are no longer referenced in the source, unless a service still uses them
+func pruneNetworks(ctx context.Context, client StackClient, events EventSink, namespace docker_cli_compose_convert.Namespace, networks map[string]docker_api_types.NetworkCreate) []error {
+	oldNetworks, err := getStackNetworks(ctx, client, namespace.Name())
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)}
+	}
+	used, err := getUsedNetworks(ctx, client)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_PRUNE, fmt.Errorf("Could not list the services that use the networks: %s", err))}
+	}
+
+	return removeNetworks(ctx, client, events, selectPrunedNetworks(namespace, oldNetworks, networks, used))
+}
+
+// selectPrunedNetworks picks the stack networks that are no longer referenced in the source and that no service uses, sorted by name
+func selectPrunedNetworks(namespace docker_cli_compose_convert.Namespace, oldNetworks []docker_api_types.NetworkResource, networks map[string]docker_api_types.NetworkCreate, used map[string]bool) []docker_api_types.NetworkResource {
+	pruneNetworks := []docker_api_types.NetworkResource{}
+	for _, network := range oldNetworks {
+		if _, exists := networks[namespace.Descope(network.Name)]; exists || used[network.ID] || used[network.Name] {
+			continue
+		}
+		pruneNetworks = append(pruneNetworks, network)
+	}
+	sort.Slice(pruneNetworks, func(i, j int) bool { return pruneNetworks[i].Name < pruneNetworks[j].Name })
+	return pruneNetworks
+}
+
+// selectMissingNetworks picks the internal names of the stack networks that don't exist yet, sorted
+func selectMissingNetworks(namespace docker_cli_compose_convert.Namespace, existingNetworks []docker_api_types.NetworkResource, networks map[string]docker_api_types.NetworkCreate) []string {
+	existingNetworkMap := make(map[string]docker_api_types.NetworkResource)
+	for _, network := range existingNetworks {
+		existingNetworkMap[network.Name] = network
+	}
+
+	missing := []string{}
+	for internalName := range networks {
+		if _, exists := existingNetworkMap[namespace.Scope(internalName)]; !exists {
+			missing = append(missing, internalName)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// resourceUsage collects the networks and secrets that services use, by both the name and the id used to refer to them
+type resourceUsage struct {
+	networks map[string]bool
+	secrets  map[string]bool
+}
+
+func newResourceUsage() resourceUsage {
+	return resourceUsage{
+		networks: map[string]bool{},
+		secrets:  map[string]bool{},
+	}
+}
+
+// add records what a service uses; swarm keeps the networks and secrets of the previous spec for a rollback, so they are used too
+func (usage resourceUsage) add(spec, previousSpec *docker_api_types_swarm.ServiceSpec) {
+	for _, usingSpec := range []*docker_api_types_swarm.ServiceSpec{spec, previousSpec} {
+		if usingSpec == nil {
+			continue
+		}
+		for _, network := range append(usingSpec.Networks, usingSpec.TaskTemplate.Networks...) {
+			if network.Target != "" {
+				usage.networks[network.Target] = true
+			}
+		}
+		for _, ref := range usingSpec.TaskTemplate.ContainerSpec.Secrets {
+			if ref.SecretID != "" {
+				usage.secrets[ref.SecretID] = true
+			}
+			if ref.SecretName != "" {
+				usage.secrets[ref.SecretName] = true
+			}
+		}
+	}
+}
+
+// getUsage collects what all services use, or would use if swarm rolled them back
+func getUsage(ctx context.Context, client StackClient) (resourceUsage, error) {
+	// networks and secrets can be used by services outside of the stack too
+	services, err := client.ServiceList(ctx, docker_api_types.ServiceListOptions{})
+	if err != nil {
+		return resourceUsage{}, err
+	}
+
+	usage := newResourceUsage()
+	for _, service := range services {
+		usage.add(&service.Spec, service.PreviousSpec)
+	}
+	return usage, nil
+}
+
+// getUsedNetworks collects the networks that any service is attached to, or would be attached to if swarm rolled it back
+func getUsedNetworks(ctx context.Context, client StackClient) (map[string]bool, error) {
+	usage, err := getUsage(ctx, client)
+	return usage.networks, err
 }
 
 func validateExternalNetworks(
 	ctx context.Context,
-	dockerCli *docker_cli_command.DockerCli,
+	client StackClient,
 	externalNetworks []string) error {
-	client := dockerCli.Client()
-
 	for _, networkName := range externalNetworks {
 		network, err := client.NetworkInspect(ctx, networkName, false)
 		if err != nil {
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
-	docker_cli_command "github.com/docker/docker/cli/command"
 	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
 	docker_cli_compose_loader "github.com/docker/docker/cli/compose/loader"
 	docker_cli_compose_types "github.com/docker/docker/cli/compose/types"
@@ -16,46 +16,34 @@ import (
 	coach_config "github.com/CoachApplication/config"
 )
 
-func deployComposeFromCoachConfig(ctx context.Context, filename string, config coach_config.Config, env map[string]string, workingDir string, opts deployOptions) (*docker_cli_compose_types.Config, error) {
-	var configMap map[string]interface{}
-	res := config.Get(&configMap)
-
-	select {
-	case <-res.Finished():
-		if !res.Success() {
-			if errs := res.Errors(); len(errs) > 0 {
-				return nil, errs[len(errs)-1]
-			} else {
-				return nil, fmt.Errorf("Unknown error occured retrieving compose details from compose source Config")
-			}
-		}
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
-
-	confFiles := []docker_cli_compose_types.ConfigFile{
-		docker_cli_compose_types.ConfigFile{
-			Filename: filename,
-			Config:   configMap,
-		},
+// loadComposeSource loads the stack from a Coach config if one was set, or from the compose files on disk
+func loadComposeSource(ctx context.Context, client StackClient, events EventSink, opts deployOptions) (*docker_cli_compose_types.Config, error) {
+	if opts.composeConfig != nil {
+		return deployComposeFromCoachConfig(ctx, client, events, opts.composeConfig, opts)
 	}
+	return deployComposeDefault(ctx, client, events, opts)
+}
 
-	comConfDetails := docker_cli_compose_types.ConfigDetails{
-		WorkingDir:  "path",
-		ConfigFiles: confFiles,
-		Environment: env,
+// deployComposeFromCoachConfig loads the stack from a Coach config, which holds the compose definition as a map
+func deployComposeFromCoachConfig(ctx context.Context, client StackClient, events EventSink, config coach_config.Config, opts deployOptions) (*docker_cli_compose_types.Config, error) {
+	configDetails, err := getCoachConfigDetails(ctx, config, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	comConf, err := docker_cli_compose_loader.Load(comConfDetails)
-	return comConf, err
+	return loadComposeConfig(ctx, client, events, configDetails)
 }
 
-func deployComposeDefault(ctx context.Context, dockerCli *docker_cli_command.DockerCli, opts deployOptions) (*docker_cli_compose_types.Config, error) {
+// deployComposeDefault loads the stack from the compose files on disk
+func deployComposeDefault(ctx context.Context, client StackClient, events EventSink, opts deployOptions) (*docker_cli_compose_types.Config, error) {
 	configDetails, err := getConfigDetails(opts)
 	if err != nil {
 		return nil, err
 	}
+	return loadComposeConfig(ctx, client, events, configDetails)
+}
 
+// loadComposeConfig loads and checks compose details, regardless of where they came from
+func loadComposeConfig(ctx context.Context, client StackClient, events EventSink, configDetails docker_cli_compose_types.ConfigDetails) (*docker_cli_compose_types.Config, error) {
 	config, err := docker_cli_compose_loader.Load(configDetails)
 	if err != nil {
 		if fpe, ok := err.(*docker_cli_compose_loader.ForbiddenPropertiesError); ok {
@@ -68,37 +56,56 @@ func deployComposeDefault(ctx context.Context, dockerCli *docker_cli_command.Doc
 
 	unsupportedProperties := docker_cli_compose_loader.GetUnsupportedProperties(configDetails)
 	if len(unsupportedProperties) > 0 {
-		fmt.Fprintf(dockerCli.Err(), "Ignoring unsupported options: %s\n\n",
-			strings.Join(unsupportedProperties, ", "))
+		events.Emit(Event{Kind: RESOURCE_KIND_STACK, Action: RESOURCE_ACTION_LOAD, Status: EVENT_STATUS_WARNING,
+			Message: fmt.Sprintf("Ignoring unsupported options: %s\n", strings.Join(unsupportedProperties, ", "))})
 	}
 
 	deprecatedProperties := docker_cli_compose_loader.GetDeprecatedProperties(configDetails)
 	if len(deprecatedProperties) > 0 {
-		fmt.Fprintf(dockerCli.Err(), "Ignoring deprecated options:\n\n%s\n\n",
-			propertyWarnings(deprecatedProperties))
+		events.Emit(Event{Kind: RESOURCE_KIND_STACK, Action: RESOURCE_ACTION_LOAD, Status: EVENT_STATUS_WARNING,
+			Message: fmt.Sprintf("Ignoring deprecated options:\n\n%s\n", propertyWarnings(deprecatedProperties))})
 	}
 
-	if err := checkDaemonIsSwarmManager(ctx, dockerCli); err != nil {
+	if err := checkDaemonIsSwarmManager(ctx, client); err != nil {
 		return nil, err
 	}
 
 	return config, nil
 }
 
+// resolveSecretFiles makes the files of the compose secrets absolute using the working dir, as the compose loader leaves them as they were written
+func resolveSecretFiles(config *docker_cli_compose_types.Config, opts deployOptions) {
+	for name, secret := range config.Secrets {
+		if secret.External.External || secret.File == "" {
+			continue
+		}
+		secret.File = opts.resolvePath(secret.File)
+		config.Secrets[name] = secret
+	}
+}
+
 func getConfigDetails(opts deployOptions) (docker_cli_compose_types.ConfigDetails, error) {
 	var details docker_cli_compose_types.ConfigDetails
 	var err error
 
-	details.WorkingDir, err = os.Getwd()
+	details.WorkingDir, err = opts.getWorkingDir()
 	if err != nil {
 		return details, err
 	}
 
-	configFile, err := getConfigFile(opts.composefile)
+	configFiles := []docker_cli_compose_types.ConfigFile{}
+	for _, composefile := range opts.composefilesOrDefault() {
+		configFile, err := getConfigFile(opts.resolvePath(composefile))
+		if err != nil {
+			return details, err
+		}
+		configFiles = append(configFiles, *configFile)
+	}
+	// the compose loader only accepts a single file, so overrides are merged in first
+	configFile, err := mergeConfigFiles(configFiles)
 	if err != nil {
 		return details, err
 	}
-	// TODO: support multiple files
 	details.ConfigFiles = []docker_cli_compose_types.ConfigFile{*configFile}
 	details.Environment, err = buildEnvironment(os.Environ())
 	if err != nil {
@@ -107,6 +114,45 @@ func getConfigDetails(opts deployOptions) (docker_cli_compose_types.ConfigDetail
 	return details, nil
 }
 
+func getCoachConfigDetails(ctx context.Context, config coach_config.Config, opts deployOptions) (docker_cli_compose_types.ConfigDetails, error) {
+	var details docker_cli_compose_types.ConfigDetails
+	var err error
+
+	details.WorkingDir, err = opts.getWorkingDir()
+	if err != nil {
+		return details, err
+	}
+
+	var configMap map[string]interface{}
+	res := config.Get(&configMap)
+
+	select {
+	case <-res.Finished():
+		if !res.Success() {
+			if errs := res.Errors(); len(errs) > 0 {
+				return details, errs[len(errs)-1]
+			} else {
+				return details, fmt.Errorf("Unknown error occured retrieving compose details from compose source Config")
+			}
+		}
+	case <-ctx.Done():
+		return details, ctx.Err()
+	}
+
+	details.ConfigFiles = []docker_cli_compose_types.ConfigFile{
+		docker_cli_compose_types.ConfigFile{
+			// there is no file on disk, so the config is named as if it were the default project compose file
+			Filename: filepath.Join(details.WorkingDir, defaultComposefile),
+			Config:   configMap,
+		},
+	}
+	details.Environment, err = buildEnvironment(os.Environ())
+	if err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
 func buildEnvironment(env []string) (map[string]string, error) {
 	result := make(map[string]string, len(env))
 	for _, s := range env {
@@ -139,39 +185,62 @@ func getConfigFile(filename string) (*docker_cli_compose_types.ConfigFile, error
  * Actual deploy
  */
 
-func deployComposeConfig(ctx context.Context, dockerCli *docker_cli_command.DockerCli, config *docker_cli_compose_types.Config, opts deployOptions) error {
+func deployComposeConfig(ctx context.Context, client StackClient, events EventSink, registryAuth registryAuthFunc, config *docker_cli_compose_types.Config, opts deployOptions) (*RollbackReport, error) {
 	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
 
+	// broken dependencies are caught before anything is changed
+	dependencies := getServiceDependencies(config.Services)
+	if _, err := dependencyLevels(getServiceNames(config.Services), dependencies); err != nil {
+		return nil, err
+	}
+
+	// prune failures don't stop the deploy, but are still reported once it is done
+	errs := []error{}
 	if opts.prune {
 		services := map[string]struct{}{}
 		for _, service := range config.Services {
 			services[service.Name] = struct{}{}
 		}
-		pruneServices(ctx, dockerCli, namespace, services)
+		errs = append(errs, pruneServices(ctx, client, events, namespace, services, opts.parallelism)...)
 	}
 
 	serviceNetworks := getServicesDeclaredNetworks(config.Services)
 	networks, externalNetworks := docker_cli_compose_convert.Networks(namespace, config.Networks, serviceNetworks)
-	if err := validateExternalNetworks(ctx, dockerCli, externalNetworks); err != nil {
-		return err
+	if err := validateExternalNetworks(ctx, client, externalNetworks); err != nil {
+		return nil, errorsOrNil(append(errs, err))
 	}
-	if err := createNetworks(ctx, dockerCli, namespace, networks); err != nil {
-		return err
+	if err := createNetworks(ctx, client, events, namespace, networks); err != nil {
+		return nil, errorsOrNil(append(errs, err))
 	}
 
+	resolveSecretFiles(config, opts)
 	secrets, err := docker_cli_compose_convert.Secrets(namespace, config.Secrets)
 	if err != nil {
-		return err
+		return nil, errorsOrNil(append(errs, err))
+	}
+	secrets = versionSecrets(secrets)
+	if err := createSecrets(ctx, client, events, namespace, secrets, opts.parallelism); err != nil {
+		return nil, errorsOrNil(append(errs, err))
 	}
-	if err := createSecrets(ctx, dockerCli, namespace, secrets); err != nil {
-		return err
+
+	services, err := docker_cli_compose_convert.Services(namespace, config, newConvertClient(client, secrets))
+	if err != nil {
+		return nil, errorsOrNil(append(errs, err))
 	}
+	useSecretVersions(services, secrets)
 
-	services, err := docker_cli_compose_convert.Services(namespace, config, dockerCli.Client())
+	report, err := deployServicesWithRollback(ctx, client, events, services, dependencies, namespace, registryAuth, opts)
 	if err != nil {
-		return err
+		return report, errorsOrNil(append(errs, err))
+	}
+	// old secret versions are only removed once the services have moved off them
+	errs = append(errs, removeUnusedSecretVersions(ctx, client, events, namespace, secrets, opts.parallelism)...)
+	// the same goes for networks and secrets that were dropped from the stack
+	if opts.prune {
+		errs = append(errs, pruneNetworks(ctx, client, events, namespace, networks)...)
+		errs = append(errs, pruneSecrets(ctx, client, events, namespace, secrets)...)
 	}
-	return deployServices(ctx, dockerCli, services, namespace, opts.sendRegistryAuth)
+	return nil, errorsOrNil(errs)
 }
 
 func getServicesDeclaredNetworks(serviceConfigs []docker_cli_compose_types.ServiceConfig) map[string]struct{} {
@@ -0,0 +1,107 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+// testCoachConfig is a Coach config holding a compose definition
+type testCoachConfig struct {
+	config map[string]interface{}
+}
+
+func (tcc *testCoachConfig) Get(target interface{}) api.Result {
+	res := base.NewResult()
+	if typed, ok := target.(*map[string]interface{}); ok {
+		*typed = tcc.config
+		res.MarkSucceeded()
+	} else {
+		res.AddError(fmt.Errorf("Unexpected config target %T", target))
+		res.MarkFailed()
+	}
+	res.MarkFinished()
+	return res.Result()
+}
+
+func (tcc *testCoachConfig) Set(source interface{}) api.Result {
+	res := base.NewResult()
+	res.AddError(fmt.Errorf("The test config is read only"))
+	res.MarkFailed()
+	res.MarkFinished()
+	return res.Result()
+}
+
+func TestGetCoachConfigDetailsUsesTheWorkingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	composeMap := map[string]interface{}{"version": "3"}
+	opts := newDeployOptionsForProject(dir)
+	details, err := getCoachConfigDetails(context.Background(), &testCoachConfig{config: composeMap}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected config error: %s", err)
+	}
+
+	if details.WorkingDir != dir {
+		t.Errorf("Expected working dir %s, got %s", dir, details.WorkingDir)
+	}
+	if len(details.ConfigFiles) != 1 || details.ConfigFiles[0].Filename != filepath.Join(dir, defaultComposefile) || !reflect.DeepEqual(details.ConfigFiles[0].Config, composeMap) {
+		t.Errorf("The config was not provided as the project compose file: %#v", details.ConfigFiles)
+	}
+
+	// relative working dirs are made absolute
+	opts.workingDir = "project"
+	details, err = getCoachConfigDetails(context.Background(), &testCoachConfig{config: composeMap}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected config error: %s", err)
+	}
+	if expected, _ := filepath.Abs("project"); details.WorkingDir != expected {
+		t.Errorf("Expected working dir %s, got %s", expected, details.WorkingDir)
+	}
+}
+
+func TestRunDeployResolvesCoachConfigPathsAgainstTheWorkingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	swarm := fakeswarm.NewSwarm()
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+	opts.composeConfig = &testCoachConfig{config: map[string]interface{}{
+		"version": "3",
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{
+				"image":   "nginx",
+				"volumes": []interface{}{"./data:/data"},
+			},
+		},
+	}}
+	if _, err := runDeploy(context.Background(), swarm, &recordingEventSink{}, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	web, found := swarm.Service("test_web")
+	if !found {
+		t.Fatal("The web service was not created")
+	}
+	mounts := web.Spec.TaskTemplate.ContainerSpec.Mounts
+	if len(mounts) != 1 || mounts[0].Source != filepath.Join(dir, "data") {
+		t.Errorf("Expected the bind mount to be resolved against %s, got %#v", dir, mounts)
+	}
+}
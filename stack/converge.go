@@ -0,0 +1,203 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_filters "github.com/docker/docker/api/types/filters"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+)
+
+/**
+ * Deploying only hands new service specs to the swarm, so waiting for
+ * convergence polls the services and their tasks until the swarm has acted
+ * on them: every desired task is running and no update is in progress.
+ *
+ * Update states and task failures are timestamped by the daemon, so they
+ * are compared with the time on the daemon, as the client clock can be far
+ * off from it.
+ *
+ * The swarm can look converged for a moment before it has picked up an
+ * update, so a service has to stay converged for a short while before it
+ * is reported as done, like the docker CLI does.
+ */
+
+var convergenceStabilityDelay = 5 * time.Second
+
+// waitForConvergence polls the deployed services until all of them have converged, failed or the timeout has passed
+//
+// since is the daemon time from before the services were deployed: update
+// states and task failures from before then were left by earlier deploys,
+// and are not reported.
+func waitForConvergence(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	namespace docker_cli_compose_convert.Namespace,
+	services map[string]docker_api_types_swarm.ServiceSpec,
+	since time.Time,
+	timeout time.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pending := map[string]bool{}
+	for internalName := range services {
+		name := namespace.Scope(internalName)
+		pending[name] = true
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_CONVERGE, Status: EVENT_STATUS_STARTED})
+	}
+
+	errs := []error{}
+	convergedSince := map[string]time.Time{}
+	reportedTasks := map[string]bool{}
+	for len(pending) > 0 {
+		stackServices, err := getStackServices(ctx, client, namespace.Name())
+		if err != nil && ctx.Err() == nil {
+			return errorsOrNil(append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)))
+		}
+
+		found := map[string]bool{}
+		for _, service := range stackServices {
+			name := service.Spec.Name
+			if !pending[name] {
+				continue
+			}
+			found[name] = true
+
+			converged, err := checkServiceConvergence(ctx, client, events, service, since, reportedTasks)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				errs = append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_CONVERGE, err))
+				delete(pending, name)
+				continue
+			}
+
+			if !converged {
+				delete(convergedSince, name)
+				continue
+			}
+			if _, seen := convergedSince[name]; !seen {
+				convergedSince[name] = time.Now()
+			}
+			if time.Since(convergedSince[name]) >= convergenceStabilityDelay {
+				events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_CONVERGE, Status: EVENT_STATUS_SUCCEEDED})
+				delete(pending, name)
+			}
+		}
+		if ctx.Err() == nil {
+			for name := range pending {
+				if !found[name] {
+					errs = append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_CONVERGE, fmt.Errorf("The service no longer exists")))
+					delete(pending, name)
+				}
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, name := range sortedServiceNames(pending) {
+				errs = append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_CONVERGE, fmt.Errorf("Timed out after %s waiting for the service to converge", timeout)))
+			}
+			return errorsOrNil(errs)
+		case <-time.After(taskPollInterval):
+		}
+	}
+
+	return errorsOrNil(errs)
+}
+
+// checkServiceConvergence reports whether a service currently looks converged, and fails if its update was paused or rolled back
+func checkServiceConvergence(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	service docker_api_types_swarm.Service,
+	since time.Time,
+	reportedTasks map[string]bool,
+) (bool, error) {
+	if status := service.UpdateStatus; status != nil && (status.State == docker_api_types_swarm.UpdateStateUpdating || isCurrentUpdate(status, since)) {
+		switch status.State {
+		case docker_api_types_swarm.UpdateStatePaused:
+			return false, fmt.Errorf("The service update was paused: %s", status.Message)
+		case docker_api_types_swarm.UpdateStateRollbackStarted,
+			docker_api_types_swarm.UpdateStateRollbackPaused,
+			docker_api_types_swarm.UpdateStateRollbackCompleted:
+			return false, fmt.Errorf("The service update was rolled back: %s", status.Message)
+		case docker_api_types_swarm.UpdateStateUpdating:
+			return false, nil
+		}
+	}
+
+	filter := docker_api_types_filters.NewArgs()
+	filter.Add("service", service.ID)
+	tasks, err := client.TaskList(ctx, docker_api_types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return false, err
+	}
+
+	desired, running := 0, 0
+	for _, task := range tasks {
+		// failures are retried by the swarm, so they are only warned about, once per task
+		if (task.Status.State == docker_api_types_swarm.TaskStateFailed || task.Status.State == docker_api_types_swarm.TaskStateRejected) &&
+			!reportedTasks[task.ID] && !task.Status.Timestamp.Before(since) {
+			reportedTasks[task.ID] = true
+			events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: service.Spec.Name, Action: RESOURCE_ACTION_CONVERGE, Status: EVENT_STATUS_WARNING,
+				Message: fmt.Sprintf("Task %s of service %s %s: %s", task.ID, service.Spec.Name, task.Status.State, task.Status.Err)})
+		}
+
+		if task.DesiredState != docker_api_types_swarm.TaskStateRunning {
+			continue
+		}
+		desired++
+		if task.Status.State == docker_api_types_swarm.TaskStateRunning {
+			running++
+		}
+	}
+
+	if service.Spec.Mode.Global != nil {
+		// global services have a task per eligible node, which can't be known here, so at least one is expected
+		return desired > 0 && running == desired, nil
+	}
+	replicas := 1
+	if mode := service.Spec.Mode.Replicated; mode != nil && mode.Replicas != nil {
+		replicas = int(*mode.Replicas)
+	}
+	return desired == replicas && running == desired, nil
+}
+
+func sortedServiceNames(names map[string]bool) []string {
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// getDaemonTime provides the current time on the daemon, which the swarm timestamps updates and tasks with
+func getDaemonTime(ctx context.Context, client StackClient) (time.Time, error) {
+	info, err := client.Info(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	daemonTime, err := time.Parse(time.RFC3339Nano, info.SystemTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Could not read the daemon time %q: %s", info.SystemTime, err)
+	}
+	return daemonTime, nil
+}
+
+// isCurrentUpdate reports whether an update status belongs to an update started since the deploy, rather than to an earlier one
+func isCurrentUpdate(status *docker_api_types_swarm.UpdateStatus, since time.Time) bool {
+	return status.StartedAt != nil && !status.StartedAt.Before(since)
+}
@@ -0,0 +1,143 @@
+package stack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func init() {
+	convergenceStabilityDelay = 0
+}
+
+func createReplicatedService(t *testing.T, swarm *fakeswarm.Swarm, namespace docker_cli_compose_convert.Namespace, name string, replicas uint64) (string, map[string]docker_api_types_swarm.ServiceSpec) {
+	spec := testServiceSpec(namespace, name, "nginx")
+	spec.Mode.Replicated = &docker_api_types_swarm.ReplicatedService{Replicas: &replicas}
+
+	created, err := swarm.ServiceCreate(context.Background(), spec, docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.ID, map[string]docker_api_types_swarm.ServiceSpec{name: spec}
+}
+
+func addServiceTask(swarm *fakeswarm.Swarm, serviceID string, state docker_api_types_swarm.TaskState) {
+	swarm.AddTask(docker_api_types_swarm.Task{
+		ServiceID:    serviceID,
+		DesiredState: docker_api_types_swarm.TaskStateRunning,
+		Status:       docker_api_types_swarm.TaskStatus{State: state, Timestamp: time.Now()},
+	})
+}
+
+func TestWaitForConvergenceWhenReplicasAreRunning(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	id, services := createReplicatedService(t, swarm, namespace, "web", 2)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+
+	if err := waitForConvergence(context.Background(), swarm, events, namespace, services, time.Now(), time.Second); err != nil {
+		t.Fatalf("Unexpected convergence error: %s", err)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_CONVERGE, EVENT_STATUS_SUCCEEDED) {
+		t.Error("No convergence event was emitted for service test_web")
+	}
+}
+
+func TestWaitForConvergenceFailsOnRollback(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	since := time.Now()
+	id, services := createReplicatedService(t, swarm, namespace, "web", 1)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+	startedAt := time.Now()
+	swarm.SetServiceUpdateStatus(id, &docker_api_types_swarm.UpdateStatus{
+		State:     docker_api_types_swarm.UpdateStateRollbackCompleted,
+		StartedAt: &startedAt,
+		Message:   "rollback completed",
+	})
+
+	err := waitForConvergence(context.Background(), swarm, events, namespace, services, since, time.Second)
+	if err == nil {
+		t.Fatal("A rolled back service was reported as converged")
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_CONVERGE, EVENT_STATUS_FAILED) {
+		t.Error("No convergence failure event was emitted for service test_web")
+	}
+}
+
+func TestWaitForConvergenceIgnoresEarlierRollback(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	id, services := createReplicatedService(t, swarm, namespace, "web", 1)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+	startedAt := time.Now().Add(-time.Hour)
+	swarm.SetServiceUpdateStatus(id, &docker_api_types_swarm.UpdateStatus{
+		State:     docker_api_types_swarm.UpdateStateRollbackCompleted,
+		StartedAt: &startedAt,
+		Message:   "rollback completed",
+	})
+
+	if err := waitForConvergence(context.Background(), swarm, events, namespace, services, time.Now(), time.Second); err != nil {
+		t.Fatalf("A rollback from an earlier deploy failed convergence: %s", err)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_CONVERGE, EVENT_STATUS_SUCCEEDED) {
+		t.Error("No convergence event was emitted for service test_web")
+	}
+}
+
+func TestWaitForConvergenceUsesTheDaemonClock(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	// the daemon clock is an hour behind, so its updates look old to the client
+	swarm.SetClockOffset(-time.Hour)
+	since, err := getDaemonTime(context.Background(), swarm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, services := createReplicatedService(t, swarm, namespace, "web", 1)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+	startedAt := time.Now().Add(-time.Hour)
+	swarm.SetServiceUpdateStatus(id, &docker_api_types_swarm.UpdateStatus{
+		State:     docker_api_types_swarm.UpdateStateRollbackCompleted,
+		StartedAt: &startedAt,
+		Message:   "rollback completed",
+	})
+
+	if err := waitForConvergence(context.Background(), swarm, events, namespace, services, since, time.Second); err == nil {
+		t.Fatal("A service rolled back by a daemon with a slow clock was reported as converged")
+	}
+}
+
+func TestWaitForConvergenceTimesOut(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	id, services := createReplicatedService(t, swarm, namespace, "web", 2)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStateRunning)
+	addServiceTask(swarm, id, docker_api_types_swarm.TaskStatePreparing)
+
+	err := waitForConvergence(context.Background(), swarm, events, namespace, services, time.Now(), 10*time.Millisecond)
+	errs, ok := err.(StackErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected a single timeout error, got: %#v", err)
+	}
+	if resourceErr, ok := errs[0].(*ResourceError); !ok || resourceErr.Name != "test_web" {
+		t.Errorf("Timeout error does not name service test_web: %s", errs[0])
+	}
+}
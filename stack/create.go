@@ -2,7 +2,8 @@ package stack
 
 import (
 	"context"
-	"fmt"
+	"sort"
+
 	docker_api_types "github.com/docker/docker/api/types"
 	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
 	docker_cli_command "github.com/docker/docker/cli/command"
@@ -12,83 +13,127 @@ import (
 
 var defaultNetworkDriver = "overlay"
 
+// registryAuthFunc retrieves an encoded registry auth token for an image
+type registryAuthFunc func(ctx context.Context, image string) (string, error)
+
+// dockerCliRegistryAuth retrieves registry auth using the credentials configured for a DockerCli
+func dockerCliRegistryAuth(dockerCli *docker_cli_command.DockerCli) registryAuthFunc {
+	return func(ctx context.Context, image string) (string, error) {
+		return docker_cli_command.RetrieveAuthTokenFromImage(ctx, dockerCli, image)
+	}
+}
+
+// noRegistryAuth is used when no registry auth is sent
+func noRegistryAuth(ctx context.Context, image string) (string, error) {
+	return "", nil
+}
+
+// createSecrets creates each secret version that doesn't exist yet, in parallel, returning an error for every secret that failed
 func createSecrets(
 	ctx context.Context,
-	dockerCli *docker_cli_command.DockerCli,
+	client StackClient,
+	events EventSink,
 	namespace docker_cli_compose_convert.Namespace,
 	secrets []docker_api_types_swarm.SecretSpec,
+	parallelism int,
 ) error {
-	client := dockerCli.Client()
-
-	for _, secretSpec := range secrets {
-		secret, _, err := client.SecretInspectWithRaw(ctx, secretSpec.Name)
-		if err == nil {
-			// secret already exists, then we update that
-			if err := client.SecretUpdate(ctx, secret.ID, secret.Meta.Version, secretSpec); err != nil {
-				return err
-			}
-		} else if docker_client.IsErrSecretNotFound(err) {
-			// secret does not exist, then we create a new one.
-			if _, err := client.SecretCreate(ctx, secretSpec); err != nil {
-				return err
-			}
-		} else {
-			return err
+	sorted := append([]docker_api_types_swarm.SecretSpec{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	return errorsOrNil(runParallel(len(sorted), parallelism, events, func(i int, events EventSink) error {
+		return createSecret(ctx, client, events, sorted[i])
+	}))
+}
+
+func createSecret(ctx context.Context, client StackClient, events EventSink, secretSpec docker_api_types_swarm.SecretSpec) error {
+	secret, _, err := client.SecretInspectWithRaw(ctx, secretSpec.Name)
+	if err == nil {
+		// the version name holds a hash of the content, so only the labels can have changed
+		if labelsEqual(secret.Spec.Labels, secretSpec.Labels) {
+			events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_UNCHANGED, Message: "id: " + secret.ID})
+			return nil
+		}
+
+		// swarm refuses updates that carry secret data
+		update := secret.Spec
+		update.Labels = secretSpec.Labels
+		update.Data = nil
+
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_STARTED})
+		if err := client.SecretUpdate(ctx, secret.ID, secret.Meta.Version, update); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SECRET, secretSpec.Name, RESOURCE_ACTION_UPDATE, err)
+		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_SUCCEEDED})
+	} else if docker_client.IsErrNotFound(err) {
+		// secret does not exist, then we create a new one.
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_STARTED})
+		if _, err := client.SecretCreate(ctx, secretSpec); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SECRET, secretSpec.Name, RESOURCE_ACTION_CREATE, err)
 		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_SUCCEEDED})
+	} else {
+		return reportResourceError(events, RESOURCE_KIND_SECRET, secretSpec.Name, RESOURCE_ACTION_INSPECT, err)
 	}
 	return nil
 }
 
+// labelsEqual compares labels, treating missing labels the same as empty labels
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, found := b[key]; !found || other != value {
+			return false
+		}
+	}
+	return true
+}
+
 func createNetworks(
 	ctx context.Context,
-	dockerCli *docker_cli_command.DockerCli,
+	client StackClient,
+	events EventSink,
 	namespace docker_cli_compose_convert.Namespace,
 	networks map[string]docker_api_types.NetworkCreate,
 ) error {
-	client := dockerCli.Client()
-
 	existingNetworks, err := getStackNetworks(ctx, client, namespace.Name())
 	if err != nil {
-		return err
+		return reportResourceError(events, RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
 	}
 
-	existingNetworkMap := make(map[string]docker_api_types.NetworkResource)
-	for _, network := range existingNetworks {
-		existingNetworkMap[network.Name] = network
-	}
-
-	for internalName, createOpts := range networks {
+	for _, internalName := range selectMissingNetworks(namespace, existingNetworks, networks) {
 		name := namespace.Scope(internalName)
-		if _, exists := existingNetworkMap[name]; exists {
-			continue
-		}
-
+		createOpts := networks[internalName]
 		if createOpts.Driver == "" {
 			createOpts.Driver = defaultNetworkDriver
 		}
 
-		fmt.Fprintf(dockerCli.Out(), "Creating network %s\n", name)
+		events.Emit(Event{Kind: RESOURCE_KIND_NETWORK, Name: name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_STARTED})
 		if _, err := client.NetworkCreate(ctx, name, createOpts); err != nil {
-			return err
+			return reportResourceError(events, RESOURCE_KIND_NETWORK, name, RESOURCE_ACTION_CREATE, err)
 		}
+		events.Emit(Event{Kind: RESOURCE_KIND_NETWORK, Name: name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_SUCCEEDED})
 	}
 
 	return nil
 }
 
+// deployServices creates or updates each service, in parallel, returning an error for every service that failed
 func deployServices(
 	ctx context.Context,
-	dockerCli *docker_cli_command.DockerCli,
+	apiClient StackClient,
+	events EventSink,
 	services map[string]docker_api_types_swarm.ServiceSpec,
 	namespace docker_cli_compose_convert.Namespace,
 	sendAuth bool,
+	registryAuth registryAuthFunc,
+	journal *deployJournal,
+	parallelism int,
 ) error {
-	apiClient := dockerCli.Client()
-	out := dockerCli.Out()
-
 	existingServices, err := getStackServices(ctx, apiClient, namespace.Name())
 	if err != nil {
-		return err
+		return reportResourceError(events, RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)
 	}
 
 	existingServiceMap := make(map[string]docker_api_types_swarm.Service)
@@ -96,51 +141,94 @@ func deployServices(
 		existingServiceMap[service.Spec.Name] = service
 	}
 
-	for internalName, serviceSpec := range services {
+	networkIds, err := getNetworkIds(ctx, apiClient)
+	if err != nil {
+		return reportResourceError(events, RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	internalNames := []string{}
+	for internalName := range services {
+		internalNames = append(internalNames, internalName)
+	}
+	sort.Strings(internalNames)
+
+	errs := runParallel(len(internalNames), parallelism, events, func(i int, events EventSink) error {
+		internalName := internalNames[i]
 		name := namespace.Scope(internalName)
+		service, exists := existingServiceMap[name]
+		return deployService(ctx, apiClient, events, name, services[internalName], service, exists, networkIds, sendAuth, registryAuth, journal)
+	})
+	journal.endBatch()
+	return errorsOrNil(errs)
+}
+
+// deployService creates a service, or updates the existing service if it has changed
+func deployService(
+	ctx context.Context,
+	apiClient StackClient,
+	events EventSink,
+	name string,
+	serviceSpec docker_api_types_swarm.ServiceSpec,
+	service docker_api_types_swarm.Service,
+	exists bool,
+	networkIds map[string]string,
+	sendAuth bool,
+	registryAuth registryAuthFunc,
+	journal *deployJournal,
+) error {
+	// updating a service to the same spec still bumps its version, and can restart its tasks
+	if exists && len(serviceSpecChanges(service.Spec, serviceSpec, networkIds)) == 0 {
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_UNCHANGED, Message: "id: " + service.ID})
+		return nil
+	}
+
+	encodedAuth := ""
+	if sendAuth {
+		// Retrieve encoded auth token from the image reference
+		image := serviceSpec.TaskTemplate.ContainerSpec.Image
+		var err error
+		encodedAuth, err = registryAuth(ctx, image)
+		if err != nil {
+			return err
+		}
+	}
 
-		encodedAuth := ""
+	if exists {
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_STARTED, Message: "id: " + service.ID})
+
+		updateOpts := docker_api_types.ServiceUpdateOptions{}
 		if sendAuth {
-			// Retrieve encoded auth token from the image reference
-			image := serviceSpec.TaskTemplate.ContainerSpec.Image
-			encodedAuth, err = docker_cli_command.RetrieveAuthTokenFromImage(ctx, dockerCli, image)
-			if err != nil {
-				return err
-			}
+			updateOpts.EncodedRegistryAuth = encodedAuth
+		}
+		response, err := apiClient.ServiceUpdate(
+			ctx,
+			service.ID,
+			service.Version,
+			serviceSpec,
+			updateOpts,
+		)
+		if err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_UPDATE, err)
+		}
+		journal.recordUpdate(name, service.ID, service.Spec)
+
+		for _, warning := range response.Warnings {
+			events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_WARNING, Message: warning})
 		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_SUCCEEDED})
+	} else {
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_STARTED})
 
-		if service, exists := existingServiceMap[name]; exists {
-			fmt.Fprintf(out, "Updating service %s (id: %s)\n", name, service.ID)
-
-			updateOpts := docker_api_types.ServiceUpdateOptions{}
-			if sendAuth {
-				updateOpts.EncodedRegistryAuth = encodedAuth
-			}
-			response, err := apiClient.ServiceUpdate(
-				ctx,
-				service.ID,
-				service.Version,
-				serviceSpec,
-				updateOpts,
-			)
-			if err != nil {
-				return err
-			}
-
-			for _, warning := range response.Warnings {
-				fmt.Fprintln(dockerCli.Err(), warning)
-			}
-		} else {
-			fmt.Fprintf(out, "Creating service %s\n", name)
-
-			createOpts := docker_api_types.ServiceCreateOptions{}
-			if sendAuth {
-				createOpts.EncodedRegistryAuth = encodedAuth
-			}
-			if _, err := apiClient.ServiceCreate(ctx, serviceSpec, createOpts); err != nil {
-				return err
-			}
+		createOpts := docker_api_types.ServiceCreateOptions{}
+		if sendAuth {
+			createOpts.EncodedRegistryAuth = encodedAuth
+		}
+		response, err := apiClient.ServiceCreate(ctx, serviceSpec, createOpts)
+		if err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_CREATE, err)
 		}
+		journal.recordCreate(name, response.ID)
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_CREATE, Status: EVENT_STATUS_SUCCEEDED})
 	}
 
 	return nil
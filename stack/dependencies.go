@@ -0,0 +1,189 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+	docker_cli_compose_types "github.com/docker/docker/cli/compose/types"
+)
+
+/**
+ * Services are deployed in dependency levels built from compose depends_on:
+ * a level only holds services whose dependencies are all in earlier levels.
+ *
+ * When the deploy waits for convergence, the services that a level depends
+ * on also have to converge before the level is deployed, which blocks for
+ * up to the wait timeout per level. Swarm only reports a task with a
+ * healthcheck as running once it is healthy, so this also waits for
+ * dependencies to become healthy. Dependencies that the deploy left
+ * unchanged are already running, and are not waited for. Without waiting,
+ * levels are still deployed in order, but the swarm starts them together.
+ */
+
+// getServiceDependencies maps each compose service to the services it depends on
+func getServiceDependencies(serviceConfigs []docker_cli_compose_types.ServiceConfig) map[string][]string {
+	dependencies := map[string][]string{}
+	for _, serviceConfig := range serviceConfigs {
+		if len(serviceConfig.DependsOn) > 0 {
+			dependencies[serviceConfig.Name] = serviceConfig.DependsOn
+		}
+	}
+	return dependencies
+}
+
+// getServiceNames lists the compose services
+func getServiceNames(serviceConfigs []docker_cli_compose_types.ServiceConfig) []string {
+	names := []string{}
+	for _, serviceConfig := range serviceConfigs {
+		names = append(names, serviceConfig.Name)
+	}
+	return names
+}
+
+// dependencyLevels orders services so that every service comes in a later level than the services it depends on
+func dependencyLevels(names []string, dependencies map[string][]string) ([][]string, error) {
+	names = append([]string{}, names...)
+	sort.Strings(names)
+
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+	}
+	for _, name := range names {
+		for _, dependency := range dependencies[name] {
+			if !exists[dependency] {
+				return nil, fmt.Errorf("Service %s depends on service %s, which is not part of the stack", name, dependency)
+			}
+		}
+	}
+
+	placed := map[string]bool{}
+	levels := [][]string{}
+	for len(placed) < len(names) {
+		level := []string{}
+		for _, name := range names {
+			if placed[name] {
+				continue
+			}
+			ready := true
+			for _, dependency := range dependencies[name] {
+				if !placed[dependency] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, name)
+			}
+		}
+
+		if len(level) == 0 {
+			return nil, fmt.Errorf("Services have circular depends_on: %s", strings.Join(findDependencyCycle(names, dependencies, placed), " -> "))
+		}
+		for _, name := range level {
+			placed[name] = true
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// findDependencyCycle follows the dependencies of the unplaced services until one repeats, which must happen if none can be placed
+func findDependencyCycle(names []string, dependencies map[string][]string, placed map[string]bool) []string {
+	path := []string{}
+	visited := map[string]int{}
+
+	current := ""
+	for _, name := range names {
+		if !placed[name] {
+			current = name
+			break
+		}
+	}
+	for {
+		if index, seen := visited[current]; seen {
+			return append(path[index:], current)
+		}
+		visited[current] = len(path)
+		path = append(path, current)
+
+		for _, dependency := range dependencies[current] {
+			if !placed[dependency] {
+				current = dependency
+				break
+			}
+		}
+	}
+}
+
+// deployServicesInOrder deploys services one dependency level at a time, and if the deploy waits, waits for the changed services that later levels depend on to converge
+func deployServicesInOrder(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	services map[string]docker_api_types_swarm.ServiceSpec,
+	dependencies map[string][]string,
+	namespace docker_cli_compose_convert.Namespace,
+	registryAuth registryAuthFunc,
+	journal *deployJournal,
+	opts deployOptions,
+) error {
+	names := []string{}
+	for name := range services {
+		names = append(names, name)
+	}
+	levels, err := dependencyLevels(names, dependencies)
+	if err != nil {
+		return err
+	}
+
+	dependedOn := map[string]bool{}
+	for _, serviceDependencies := range dependencies {
+		for _, dependency := range serviceDependencies {
+			dependedOn[dependency] = true
+		}
+	}
+
+	for _, level := range levels {
+		levelServices := map[string]docker_api_types_swarm.ServiceSpec{}
+		for _, name := range level {
+			levelServices[name] = services[name]
+		}
+
+		var since time.Time
+		if opts.wait {
+			daemonTime, err := getDaemonTime(ctx, client)
+			if err != nil {
+				return err
+			}
+			since = daemonTime
+		}
+		if err := deployServices(ctx, client, events, levelServices, namespace, opts.sendRegistryAuth, registryAuth, journal, opts.parallelism); err != nil {
+			return err
+		}
+		if !opts.wait {
+			continue
+		}
+
+		changed := journal.lastBatch()
+		readyServices := map[string]docker_api_types_swarm.ServiceSpec{}
+		for _, name := range level {
+			if dependedOn[name] && changed[namespace.Scope(name)] {
+				readyServices[name] = services[name]
+			}
+		}
+		if len(readyServices) > 0 {
+			if err := waitForConvergence(ctx, client, events, namespace, readyServices, since, opts.waitTimeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
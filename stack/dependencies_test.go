@@ -0,0 +1,134 @@
+package stack
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func TestDependencyLevels(t *testing.T) {
+	levels, err := dependencyLevels(
+		[]string{"web", "worker", "db", "cache"},
+		map[string][]string{
+			"web":    {"db", "cache"},
+			"worker": {"web"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected dependency error: %s", err)
+	}
+
+	expected := [][]string{{"cache", "db"}, {"web"}, {"worker"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Expected levels %v, got %v", expected, levels)
+	}
+}
+
+func TestDependencyLevelsDetectsCycles(t *testing.T) {
+	_, err := dependencyLevels(
+		[]string{"a", "b", "c"},
+		map[string][]string{
+			"a": {"b"},
+			"b": {"c"},
+			"c": {"a"},
+		},
+	)
+	if err == nil {
+		t.Fatal("A circular depends_on was accepted")
+	}
+	if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("The cycle is not described in the error: %s", err)
+	}
+}
+
+func TestDependencyLevelsDetectsMissingServices(t *testing.T) {
+	if _, err := dependencyLevels([]string{"web"}, map[string][]string{"web": {"db"}}); err == nil {
+		t.Fatal("A depends_on on a missing service was accepted")
+	}
+}
+
+func TestRunDeployWaitsForDependencies(t *testing.T) {
+	dir := writeComposefile(t, `
+version: "3"
+services:
+  app:
+    image: app
+    depends_on:
+      - db
+  db:
+    image: postgres
+`)
+	defer os.RemoveAll(dir)
+
+	swarm := fakeswarm.NewSwarm()
+	swarm.SetAutoRunTasks(true)
+	events := &recordingEventSink{}
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+	opts.wait = true
+
+	if _, err := runDeploy(context.Background(), swarm, events, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+	// the final convergence of the stack follows in any order
+	expected := []string{"create test_db", "converge test_db", "create test_app"}
+	if order := succeededServiceActions(events); len(order) != 5 || !reflect.DeepEqual(order[:3], expected) {
+		t.Errorf("Expected services to be deployed as %v, got %v", expected, order)
+	}
+
+	// a redeploy leaves the services unchanged, so there is nothing to wait for between the levels
+	events = &recordingEventSink{}
+	if _, err := runDeploy(context.Background(), swarm, events, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected redeploy error: %s", err)
+	}
+	expected = []string{"converge test_app", "converge test_db"}
+	order := succeededServiceActions(events)
+	sort.Strings(order)
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected only the final convergence on redeploy, got %v", order)
+	}
+}
+
+func TestRunDeployOnlyOrdersDependenciesWithoutWaiting(t *testing.T) {
+	dir := writeComposefile(t, `
+version: "3"
+services:
+  app:
+    image: app
+    depends_on:
+      - db
+  db:
+    image: postgres
+`)
+	defer os.RemoveAll(dir)
+
+	// tasks are never started, so waiting for the db would time out
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+
+	if _, err := runDeploy(context.Background(), swarm, events, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+	expected := []string{"create test_db", "create test_app"}
+	if order := succeededServiceActions(events); !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected services to be deployed as %v, got %v", expected, order)
+	}
+}
+
+// succeededServiceActions lists the service actions that succeeded, in order
+func succeededServiceActions(events *recordingEventSink) []string {
+	actions := []string{}
+	for _, event := range events.events {
+		if event.Kind == RESOURCE_KIND_SERVICE && event.Status == EVENT_STATUS_SUCCEEDED {
+			actions = append(actions, event.Action+" "+event.Name)
+		}
+	}
+	return actions
+}
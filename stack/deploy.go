@@ -0,0 +1,256 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	coach_config "github.com/CoachApplication/config"
+	docker_api "github.com/docker/docker/api"
+)
+
+const (
+	defaultComposefile = "docker-compose.yml"
+	defaultWaitTimeout = 5 * time.Minute
+)
+
+var namespaceInvalidChars = regexp.MustCompile("[^a-z0-9]")
+
+type deployOptions struct {
+	bundlefile       string
+	composefiles     []string
+	composeConfig    coach_config.Config
+	workingDir       string
+	namespace        string
+	sendRegistryAuth bool
+	prune            bool
+	wait             bool
+	waitTimeout      time.Duration
+	dryRun           bool
+	parallelism      int
+	rollback         bool
+}
+
+// newDeployOptionsDefault provides deploy options that mimic running "docker stack deploy" in the current directory
+func newDeployOptionsDefault() deployOptions {
+	wd, _ := os.Getwd()
+	return newDeployOptionsForProject(wd)
+}
+
+// newDeployOptionsForProject provides deploy options for a project, where relative paths are resolved against the project root
+func newDeployOptionsForProject(projectRoot string) deployOptions {
+	return deployOptions{
+		workingDir:  projectRoot,
+		namespace:   namespaceFromPath(projectRoot),
+		waitTimeout: defaultWaitTimeout,
+		parallelism: defaultParallelism,
+		rollback:    true,
+	}
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts deployOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	namespaceProp := &NamespaceProperty{}
+	namespaceProp.Set(opts.namespace)
+	props.Add(namespaceProp.Property())
+
+	composefilesProp := &ComposefilesProperty{}
+	composefilesProp.Set(opts.composefiles)
+	props.Add(composefilesProp.Property())
+
+	bundlefileProp := &BundlefileProperty{}
+	bundlefileProp.Set(opts.bundlefile)
+	props.Add(bundlefileProp.Property())
+
+	sendRegistryAuthProp := &SendRegistryAuthProperty{}
+	sendRegistryAuthProp.Set(opts.sendRegistryAuth)
+	props.Add(sendRegistryAuthProp.Property())
+
+	pruneProp := &PruneProperty{}
+	pruneProp.Set(opts.prune)
+	props.Add(pruneProp.Property())
+
+	waitProp := &WaitProperty{}
+	waitProp.Set(opts.wait)
+	props.Add(waitProp.Property())
+
+	waitTimeoutProp := &WaitTimeoutProperty{}
+	waitTimeoutProp.Set(int(opts.waitTimeout / time.Second))
+	props.Add(waitTimeoutProp.Property())
+
+	dryRunProp := &DryRunProperty{}
+	dryRunProp.Set(opts.dryRun)
+	props.Add(dryRunProp.Property())
+
+	parallelismProp := &ParallelismProperty{}
+	parallelismProp.Set(opts.parallelism)
+	props.Add(parallelismProp.Property())
+
+	rollbackProp := &RollbackProperty{}
+	rollbackProp.Set(opts.rollback)
+	props.Add(rollbackProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts deployOptions) withProperties(props api.Properties) deployOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_NAMESPACE); ok {
+		opts.namespace = val
+	}
+	if val, ok := propertyStrings(props, PROPERTY_ID_STACK_COMPOSEFILES); ok {
+		opts.composefiles = val
+	}
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_BUNDLEFILE); ok {
+		opts.bundlefile = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_SENDREGISTRYAUTH); ok {
+		opts.sendRegistryAuth = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_PRUNE); ok {
+		opts.prune = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_WAIT); ok {
+		opts.wait = val
+	}
+	if val, ok := propertyInt(props, PROPERTY_ID_STACK_WAITTIMEOUT); ok {
+		opts.waitTimeout = time.Duration(val) * time.Second
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_DRYRUN); ok {
+		opts.dryRun = val
+	}
+	if val, ok := propertyInt(props, PROPERTY_ID_STACK_PARALLELISM); ok {
+		opts.parallelism = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_ROLLBACK); ok {
+		opts.rollback = val
+	}
+	return opts
+}
+
+// getWorkingDir provides the directory that relative stack paths are resolved against
+func (opts deployOptions) getWorkingDir() (string, error) {
+	if opts.workingDir == "" {
+		return os.Getwd()
+	}
+	return filepath.Abs(opts.workingDir)
+}
+
+// resolvePath makes a path absolute using the working dir
+func (opts deployOptions) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if wd, err := opts.getWorkingDir(); err == nil {
+		return filepath.Join(wd, path)
+	}
+	return path
+}
+
+// composefilesOrDefault provides the compose files to deploy, falling back to the default compose file if none were set
+func (opts deployOptions) composefilesOrDefault() []string {
+	if len(opts.composefiles) == 0 {
+		return []string{defaultComposefile}
+	}
+	return opts.composefiles
+}
+
+// validate checks that the options describe a deployable stack
+func (opts deployOptions) validate() []error {
+	errs := []error{}
+
+	if err := validateNamespace(opts.namespace); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateParallelism(opts.parallelism); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.wait && opts.waitTimeout <= 0 {
+		errs = append(errs, errors.New("A positive convergence timeout is needed to wait for the stack to converge."))
+	}
+
+	switch {
+	case opts.composeConfig != nil && (opts.bundlefile != "" || len(opts.composefiles) > 0):
+		errs = append(errs, errors.New("The stack is sourced from Coach configuration, so you cannot specify a bundle file or Compose files."))
+	case opts.bundlefile != "" && len(opts.composefiles) > 0:
+		errs = append(errs, errors.New("You cannot specify both a bundle file and Compose files."))
+	case opts.composeConfig != nil:
+	case opts.bundlefile != "":
+		if err := validateFileExists(opts.resolvePath(opts.bundlefile)); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		for _, composefile := range opts.composefilesOrDefault() {
+			if err := validateFileExists(opts.resolvePath(composefile)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateNamespace checks that a namespace can be used to scope Docker object names
+func validateNamespace(namespace string) error {
+	if namespace == "" {
+		return errors.New("No stack namespace was provided.")
+	}
+	if !docker_api.RestrictedNamePattern.MatchString(namespace) {
+		return fmt.Errorf("Invalid stack namespace %q, only %s are allowed.", namespace, docker_api.RestrictedNameChars)
+	}
+	return nil
+}
+
+// validateParallelism checks that at least one stack resource can be changed at a time
+func validateParallelism(parallelism int) error {
+	if parallelism < 1 {
+		return fmt.Errorf("Invalid parallelism %d, at least one resource must be changed at a time.", parallelism)
+	}
+	return nil
+}
+
+func validateFileExists(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("Could not access stack file %s: %s", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("Stack file %s is a directory", path)
+	}
+	return nil
+}
+
+// namespaceFromPath derives a stack namespace from a project directory, the same way compose derives a project name
+func namespaceFromPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return namespaceInvalidChars.ReplaceAllString(strings.ToLower(filepath.Base(path)), "")
+}
+
+// runDeploy deploys a stack from the source described in the options, and reports any rollback made after the deploy failed
+func runDeploy(ctx context.Context, client StackClient, events EventSink, registryAuth registryAuthFunc, opts deployOptions) (*RollbackReport, error) {
+	switch {
+	case opts.namespace == "":
+		return nil, errors.New("No stack namespace was provided for the deploy.")
+	case opts.bundlefile != "" && len(opts.composefiles) > 0:
+		return nil, errors.New("You cannot specify both a bundle file and Compose files.")
+	case opts.bundlefile != "":
+		return deployBundle(ctx, client, events, registryAuth, opts)
+	default:
+		config, err := loadComposeSource(ctx, client, events, opts)
+		if err != nil {
+			return nil, err
+		}
+		return deployComposeConfig(ctx, client, events, registryAuth, config, opts)
+	}
+}
@@ -0,0 +1,426 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+var _ StackClient = fakeswarm.NewSwarm()
+
+// recordingEventSink keeps all emitted events, so that tests can check what was reported
+type recordingEventSink struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (res *recordingEventSink) Emit(event Event) {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+	res.events = append(res.events, event)
+}
+
+func (res *recordingEventSink) find(kind, name, action, status string) bool {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+	for _, event := range res.events {
+		if event.Kind == kind && event.Name == name && event.Action == action && event.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+func testServiceSpec(namespace docker_cli_compose_convert.Namespace, name, image string) docker_api_types_swarm.ServiceSpec {
+	return docker_api_types_swarm.ServiceSpec{
+		Annotations: docker_api_types_swarm.Annotations{
+			Name:   namespace.Scope(name),
+			Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil),
+		},
+		TaskTemplate: docker_api_types_swarm.TaskSpec{
+			ContainerSpec: docker_api_types_swarm.ContainerSpec{
+				Image: image,
+			},
+		},
+	}
+}
+
+func writeComposefile(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, defaultComposefile), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDeployServicesCreatesMissingServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"web": testServiceSpec(namespace, "web", "nginx"),
+		"db":  testServiceSpec(namespace, "db", "postgres"),
+	}
+	if err := deployServices(ctx, swarm, events, services, namespace, false, noRegistryAuth, nil, defaultParallelism); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	for _, name := range []string{"test_web", "test_db"} {
+		if _, found := swarm.Service(name); !found {
+			t.Errorf("Service %s was not created", name)
+		}
+		if !events.find(RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_CREATE, EVENT_STATUS_SUCCEEDED) {
+			t.Errorf("No create event was emitted for service %s", name)
+		}
+	}
+}
+
+func TestDeployServicesUpdatesExistingServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	if _, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, "web", "nginx:1.12"), docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	created, _ := swarm.Service("test_web")
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"web": testServiceSpec(namespace, "web", "nginx:1.13"),
+	}
+	if err := deployServices(ctx, swarm, events, services, namespace, false, noRegistryAuth, nil, defaultParallelism); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	updated, _ := swarm.Service("test_web")
+	if updated.ID != created.ID {
+		t.Errorf("Service was replaced instead of updated: %s became %s", created.ID, updated.ID)
+	}
+	if updated.Spec.TaskTemplate.ContainerSpec.Image != "nginx:1.13" {
+		t.Errorf("Service image was not updated: %s", updated.Spec.TaskTemplate.ContainerSpec.Image)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_UPDATE, EVENT_STATUS_SUCCEEDED) {
+		t.Error("No update event was emitted for service test_web")
+	}
+}
+
+func TestDeployServicesSkipsUnchangedServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	spec := testServiceSpec(namespace, "web", "nginx")
+	if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	created, _ := swarm.Service("test_web")
+
+	if err := deployServices(ctx, swarm, events, map[string]docker_api_types_swarm.ServiceSpec{"web": spec}, namespace, false, noRegistryAuth, nil, defaultParallelism); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	for _, call := range swarm.Calls() {
+		if call == fakeswarm.METHOD_SERVICE_UPDATE {
+			t.Error("An unchanged service was updated")
+		}
+	}
+	if deployed, _ := swarm.Service("test_web"); deployed.Version.Index != created.Version.Index {
+		t.Errorf("The version of an unchanged service was bumped from %d to %d", created.Version.Index, deployed.Version.Index)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_UPDATE, EVENT_STATUS_UNCHANGED) {
+		t.Error("No unchanged event was emitted for service test_web")
+	}
+}
+
+func TestDeployServicesReportsFailures(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	swarm.FailOn(fakeswarm.METHOD_SERVICE_CREATE, errors.New("no capacity"))
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"web": testServiceSpec(namespace, "web", "nginx"),
+	}
+	err := deployServices(ctx, swarm, events, services, namespace, false, noRegistryAuth, nil, defaultParallelism)
+	errs, ok := err.(StackErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected a single service error, got: %#v", err)
+	}
+	resourceErr, ok := errs[0].(*ResourceError)
+	if !ok {
+		t.Fatalf("Expected a ResourceError, got: %#v", errs[0])
+	}
+	if resourceErr.Kind != RESOURCE_KIND_SERVICE || resourceErr.Name != "test_web" || resourceErr.Action != RESOURCE_ACTION_CREATE {
+		t.Errorf("ResourceError does not describe the failed create: %s", resourceErr)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_web", RESOURCE_ACTION_CREATE, EVENT_STATUS_FAILED) {
+		t.Error("No failure event was emitted for service test_web")
+	}
+}
+
+func TestPruneServicesRemovesUnreferencedServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	other := docker_cli_compose_convert.NewNamespace("other")
+
+	for _, spec := range []docker_api_types_swarm.ServiceSpec{
+		testServiceSpec(namespace, "web", "nginx"),
+		testServiceSpec(namespace, "old", "busybox"),
+		testServiceSpec(other, "old", "busybox"),
+	} {
+		if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if errs := pruneServices(ctx, swarm, events, namespace, map[string]struct{}{"web": {}}, defaultParallelism); len(errs) > 0 {
+		t.Fatalf("Unexpected prune errors: %s", StackErrors(errs))
+	}
+
+	if _, found := swarm.Service("test_old"); found {
+		t.Error("Unreferenced service test_old was not pruned")
+	}
+	if _, found := swarm.Service("test_web"); !found {
+		t.Error("Referenced service test_web was pruned")
+	}
+	if _, found := swarm.Service("other_old"); !found {
+		t.Error("Service other_old from another stack was pruned")
+	}
+}
+
+func TestPruneNetworksSkipsNetworksInUse(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	labels := docker_cli_compose_convert.AddStackLabel(namespace, nil)
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "test_front", Driver: "overlay", Labels: labels})
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "test_old", Driver: "overlay", Labels: labels})
+	usedId := swarm.AddNetwork(docker_api_types.NetworkResource{Name: "test_used", Driver: "overlay", Labels: labels})
+
+	// a service outside of the stack still uses test_used
+	spec := testServiceSpec(docker_cli_compose_convert.NewNamespace("other"), "web", "nginx")
+	spec.TaskTemplate.Networks = []docker_api_types_swarm.NetworkAttachmentConfig{{Target: usedId}}
+	if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stack service was moved off test_rollback, but swarm would attach it again on a rollback
+	rollbackId := swarm.AddNetwork(docker_api_types.NetworkResource{Name: "test_rollback", Driver: "overlay", Labels: labels})
+	webSpec := testServiceSpec(namespace, "web", "nginx")
+	webSpec.TaskTemplate.Networks = []docker_api_types_swarm.NetworkAttachmentConfig{{Target: rollbackId}}
+	created, err := swarm.ServiceCreate(ctx, webSpec, docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webSpec.TaskTemplate.Networks = nil
+	if _, err := swarm.ServiceUpdate(ctx, created.ID, docker_api_types_swarm.Version{Index: 1}, webSpec, docker_api_types.ServiceUpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := pruneNetworks(ctx, swarm, events, namespace, map[string]docker_api_types.NetworkCreate{"front": {}}); len(errs) > 0 {
+		t.Fatalf("Unexpected prune errors: %s", StackErrors(errs))
+	}
+
+	names := map[string]bool{}
+	for _, network := range swarm.Networks() {
+		names[network.Name] = true
+	}
+	if names["test_old"] {
+		t.Error("Unreferenced network test_old was not pruned")
+	}
+	if !names["test_front"] {
+		t.Error("Referenced network test_front was pruned")
+	}
+	if !names["test_used"] {
+		t.Error("Network test_used was pruned while a service uses it")
+	}
+	if !names["test_rollback"] {
+		t.Error("Network test_rollback was pruned while a service would use it on a rollback")
+	}
+}
+
+func TestPruneNetworksReportsServiceListFailureAsPruneFailure(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "test_old", Driver: "overlay", Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil)})
+	swarm.FailOn(fakeswarm.METHOD_SERVICE_LIST, errors.New("connection refused"))
+
+	errs := pruneNetworks(context.Background(), swarm, events, namespace, map[string]docker_api_types.NetworkCreate{})
+	if len(errs) != 1 {
+		t.Fatalf("Expected a single prune error, got: %v", errs)
+	}
+	if resourceErr, ok := errs[0].(*ResourceError); !ok || resourceErr.Kind != RESOURCE_KIND_NETWORK || resourceErr.Action != RESOURCE_ACTION_PRUNE {
+		t.Errorf("The failure was not reported as the network prune failing: %#v", errs[0])
+	}
+	if !events.find(RESOURCE_KIND_NETWORK, "test", RESOURCE_ACTION_PRUNE, EVENT_STATUS_FAILED) {
+		t.Error("No network prune failure event was emitted")
+	}
+}
+
+func TestPruneSecretsSkipsSecretsInUse(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	secrets := versionSecrets([]docker_api_types_swarm.SecretSpec{
+		{Annotations: docker_api_types_swarm.Annotations{Name: "test_token", Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil)}, Data: []byte("s3cret")},
+	})
+	ids := map[string]string{}
+	for _, spec := range append(secrets, docker_api_types_swarm.SecretSpec{
+		Annotations: docker_api_types_swarm.Annotations{Name: "test_old", Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil)},
+	}, docker_api_types_swarm.SecretSpec{
+		Annotations: docker_api_types_swarm.Annotations{Name: "test_used", Labels: docker_cli_compose_convert.AddStackLabel(namespace, nil)},
+	}) {
+		created, err := swarm.SecretCreate(ctx, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[spec.Name] = created.ID
+	}
+
+	spec := testServiceSpec(namespace, "web", "nginx")
+	spec.TaskTemplate.ContainerSpec.Secrets = []*docker_api_types_swarm.SecretReference{{SecretID: ids["test_used"], SecretName: "test_used"}}
+	if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := pruneSecrets(ctx, swarm, events, namespace, secrets); len(errs) > 0 {
+		t.Fatalf("Unexpected prune errors: %s", StackErrors(errs))
+	}
+
+	names := map[string]bool{}
+	for _, secret := range swarm.Secrets() {
+		names[secret.Spec.Name] = true
+	}
+	if names["test_old"] {
+		t.Error("Unreferenced secret test_old was not pruned")
+	}
+	if !names[secrets[0].Name] {
+		t.Error("Referenced secret test_token was pruned")
+	}
+	if !names["test_used"] {
+		t.Error("Secret test_used was pruned while a service uses it")
+	}
+}
+
+func TestValidateExternalNetworks(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "shared", Scope: "swarm", Driver: "overlay"})
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "bridged", Scope: "local", Driver: "bridge"})
+
+	if err := validateExternalNetworks(ctx, swarm, []string{"shared"}); err != nil {
+		t.Errorf("Swarm scoped external network was rejected: %s", err)
+	}
+	if err := validateExternalNetworks(ctx, swarm, []string{"bridged"}); err == nil {
+		t.Error("Local scoped external network was accepted")
+	}
+	if err := validateExternalNetworks(ctx, swarm, []string{"missing"}); err == nil {
+		t.Error("Missing external network was accepted")
+	}
+}
+
+func TestCheckDaemonIsSwarmManager(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+
+	if err := checkDaemonIsSwarmManager(ctx, swarm); err != nil {
+		t.Errorf("Manager node was rejected: %s", err)
+	}
+
+	swarm.SetManager(false)
+	if err := checkDaemonIsSwarmManager(ctx, swarm); err == nil {
+		t.Error("Worker node was accepted")
+	}
+}
+
+func TestRunDeployFromComposefile(t *testing.T) {
+	dir := writeComposefile(t, `
+version: "3.1"
+services:
+  web:
+    image: nginx
+    networks:
+      - front
+    secrets:
+      - token
+networks:
+  front:
+secrets:
+  token:
+    file: ./token.txt
+`)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token.txt"), []byte("s3cret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+
+	if _, err := runDeploy(context.Background(), swarm, events, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+
+	service, found := swarm.Service("test_web")
+	if !found {
+		t.Fatal("Service test_web was not created")
+	}
+	version := testSecretVersion("test_token", "s3cret")
+	if secrets := service.Spec.TaskTemplate.ContainerSpec.Secrets; len(secrets) != 1 || secrets[0].SecretName != version {
+		t.Errorf("Service test_web does not reference secret %s: %#v", version, secrets)
+	}
+	if networks := swarm.Networks(); len(networks) != 1 || networks[0].Name != "test_front" {
+		t.Errorf("Expected only network test_front to be created: %#v", networks)
+	}
+}
+
+func TestRunDeployRequiresSwarmManager(t *testing.T) {
+	dir := writeComposefile(t, `
+version: "3"
+services:
+  web:
+    image: nginx
+`)
+	defer os.RemoveAll(dir)
+
+	swarm := fakeswarm.NewSwarm()
+	swarm.SetManager(false)
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+
+	if _, err := runDeploy(context.Background(), swarm, &recordingEventSink{}, noRegistryAuth, opts); err == nil {
+		t.Fatal("Deploy to a worker node succeeded")
+	}
+	if services := swarm.Services(); len(services) > 0 {
+		t.Errorf("Services were created on a worker node: %#v", services)
+	}
+}
@@ -0,0 +1,113 @@
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldDiff is a single field that differs between two specs, with both values encoded as JSON
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (fd FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s -> %s", fd.Field, fd.Old, fd.New)
+}
+
+// diffSpecs compares two values of the same type field by field, and lists the fields that differ
+func diffSpecs(old, new interface{}) []FieldDiff {
+	diffs := []FieldDiff{}
+	diffValues("", reflect.ValueOf(old), reflect.ValueOf(new), &diffs)
+	return diffs
+}
+
+func diffValues(path string, old, new reflect.Value, diffs *[]FieldDiff) {
+	if !old.IsValid() || !new.IsValid() || old.Type() != new.Type() {
+		if old.IsValid() != new.IsValid() || (old.IsValid() && !reflect.DeepEqual(old.Interface(), new.Interface())) {
+			*diffs = append(*diffs, newFieldDiff(path, old, new))
+		}
+		return
+	}
+
+	switch old.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				*diffs = append(*diffs, newFieldDiff(path, old, new))
+			}
+			return
+		}
+		diffValues(path, old.Elem(), new.Elem(), diffs)
+
+	case reflect.Struct:
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinFieldPath(path, field.Name)
+			}
+			diffValues(fieldPath, old.Field(i), new.Field(i), diffs)
+		}
+
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, key := range append(old.MapKeys(), new.MapKeys()...) {
+			keys[fmt.Sprint(key.Interface())] = key
+		}
+		names := []string{}
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			diffValues(fmt.Sprintf("%s[%s]", path, name), old.MapIndex(keys[name]), new.MapIndex(keys[name]), diffs)
+		}
+
+	case reflect.Slice:
+		// nil and empty lists mean the same to the daemon
+		if old.Len() == 0 && new.Len() == 0 {
+			return
+		}
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*diffs = append(*diffs, newFieldDiff(path, old, new))
+		}
+
+	default:
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*diffs = append(*diffs, newFieldDiff(path, old, new))
+		}
+	}
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func newFieldDiff(path string, old, new reflect.Value) FieldDiff {
+	return FieldDiff{
+		Field: path,
+		Old:   encodeFieldValue(old),
+		New:   encodeFieldValue(new),
+	}
+}
+
+func encodeFieldValue(val reflect.Value) string {
+	if !val.IsValid() {
+		return "null"
+	}
+	encoded, err := json.Marshal(val.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", val.Interface())
+	}
+	return string(encoded)
+}
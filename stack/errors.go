@@ -0,0 +1,78 @@
+package stack
+
+import (
+	"fmt"
+	"strings"
+
+	base "github.com/CoachApplication/base"
+)
+
+const (
+	RESOURCE_KIND_STACK   = "stack"
+	RESOURCE_KIND_SERVICE = "service"
+	RESOURCE_KIND_NETWORK = "network"
+	RESOURCE_KIND_SECRET  = "secret"
+
+	RESOURCE_ACTION_LOAD     = "load"
+	RESOURCE_ACTION_LIST     = "list"
+	RESOURCE_ACTION_INSPECT  = "inspect"
+	RESOURCE_ACTION_CREATE   = "create"
+	RESOURCE_ACTION_UPDATE   = "update"
+	RESOURCE_ACTION_REMOVE   = "remove"
+	RESOURCE_ACTION_CONVERGE = "converge"
+	RESOURCE_ACTION_ROLLBACK = "rollback"
+	RESOURCE_ACTION_LOGS     = "read logs of"
+	RESOURCE_ACTION_SCALE    = "scale"
+	RESOURCE_ACTION_PRUNE    = "prune"
+)
+
+// ResourceError is a failed daemon action on a single stack resource
+type ResourceError struct {
+	Kind   string
+	Name   string
+	Action string
+	Err    error
+}
+
+func newResourceError(kind, name, action string, err error) *ResourceError {
+	return &ResourceError{
+		Kind:   kind,
+		Name:   name,
+		Action: action,
+		Err:    err,
+	}
+}
+
+func (re *ResourceError) Error() string {
+	return fmt.Sprintf("Failed to %s %s %s: %s", re.Action, re.Kind, re.Name, re.Err)
+}
+
+// StackErrors aggregates all of the failures of a stack action, so that partial failures are not lost
+type StackErrors []error
+
+func (se StackErrors) Error() string {
+	msgs := []string{}
+	for _, err := range se {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// errorsOrNil converts a list of errors to a single error, which is nil if the list is empty
+func errorsOrNil(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return StackErrors(errs)
+}
+
+// addResultErrors adds an error to a result, unpacking aggregated errors so that each is reported on its own
+func addResultErrors(res *base.Result, err error) {
+	if errs, ok := err.(StackErrors); ok {
+		for _, err := range errs {
+			addResultErrors(res, err)
+		}
+		return
+	}
+	res.AddError(err)
+}
@@ -0,0 +1,283 @@
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	docker_cli_command "github.com/docker/docker/cli/command"
+)
+
+/**
+ * Stack actions report progress as events, instead of writing text, so
+ * that the same progress can be rendered to a terminal, streamed to a
+ * Coach UI through the operation result, or logged as JSON.
+ */
+
+const (
+	EVENT_STATUS_STARTED   = "started"
+	EVENT_STATUS_SUCCEEDED = "succeeded"
+	EVENT_STATUS_FAILED    = "failed"
+	EVENT_STATUS_WARNING   = "warning"
+	EVENT_STATUS_INFO      = "info"
+	EVENT_STATUS_PLANNED   = "planned"
+	EVENT_STATUS_UNCHANGED = "unchanged"
+
+	PROPERTY_ID_STACK_EVENTS = "stack.events"
+
+	resultEventBufferSize = 1024
+)
+
+// Event is a single progress report about an action on a stack resource
+type Event struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// EventSink receives stack progress events
+type EventSink interface {
+	Emit(event Event)
+}
+
+// reportResourceError emits a failure event for a resource action, and returns the matching error
+func reportResourceError(events EventSink, kind, name, action string, err error) *ResourceError {
+	events.Emit(Event{Kind: kind, Name: name, Action: action, Status: EVENT_STATUS_FAILED, Message: err.Error()})
+	return newResourceError(kind, name, action, err)
+}
+
+// MultiEventSink passes events to a number of sinks
+type MultiEventSink []EventSink
+
+func (mes MultiEventSink) Emit(event Event) {
+	for _, sink := range mes {
+		if sink != nil {
+			sink.Emit(event)
+		}
+	}
+}
+
+// WriterEventSink writes events as the human readable text that the docker stack commands produce
+type WriterEventSink struct {
+	out io.Writer
+	err io.Writer
+}
+
+func NewWriterEventSink(out, err io.Writer) *WriterEventSink {
+	return &WriterEventSink{
+		out: out,
+		err: err,
+	}
+}
+
+// NewDockerCliEventSink writes events to the output streams of a DockerCli
+func NewDockerCliEventSink(streams docker_cli_command.Streams) *WriterEventSink {
+	return NewWriterEventSink(streams.Out(), streams.Err())
+}
+
+func (wes *WriterEventSink) Emit(event Event) {
+	switch event.Status {
+	case EVENT_STATUS_STARTED:
+		if event.Message == "" {
+			fmt.Fprintf(wes.out, "%s %s %s\n", eventActionVerb(event.Action), event.Kind, event.Name)
+		} else {
+			fmt.Fprintf(wes.out, "%s %s %s (%s)\n", eventActionVerb(event.Action), event.Kind, event.Name, event.Message)
+		}
+	case EVENT_STATUS_FAILED:
+		fmt.Fprintf(wes.err, "Failed to %s %s %s: %s\n", event.Action, event.Kind, event.Name, event.Message)
+	case EVENT_STATUS_WARNING:
+		fmt.Fprintln(wes.err, event.Message)
+	case EVENT_STATUS_INFO:
+		fmt.Fprintln(wes.out, event.Message)
+	case EVENT_STATUS_UNCHANGED:
+		fmt.Fprintf(wes.out, "Skipping %s %s, which is unchanged\n", event.Kind, event.Name)
+	case EVENT_STATUS_PLANNED:
+		if event.Message == "" {
+			fmt.Fprintf(wes.out, "Would %s %s %s\n", event.Action, event.Kind, event.Name)
+		} else {
+			fmt.Fprintf(wes.out, "Would %s %s %s (%s)\n", event.Action, event.Kind, event.Name, event.Message)
+		}
+	}
+}
+
+var eventActionVerbs = map[string]string{
+	RESOURCE_ACTION_LIST:     "Listing",
+	RESOURCE_ACTION_INSPECT:  "Inspecting",
+	RESOURCE_ACTION_CREATE:   "Creating",
+	RESOURCE_ACTION_UPDATE:   "Updating",
+	RESOURCE_ACTION_REMOVE:   "Removing",
+	RESOURCE_ACTION_CONVERGE: "Waiting for",
+	RESOURCE_ACTION_ROLLBACK: "Rolling back",
+	RESOURCE_ACTION_SCALE:    "Scaling",
+	RESOURCE_ACTION_PRUNE:    "Pruning",
+}
+
+func eventActionVerb(action string) string {
+	if verb, found := eventActionVerbs[action]; found {
+		return verb
+	}
+	return strings.Title(action)
+}
+
+// JSONEventSink writes each event as a line of JSON
+type JSONEventSink struct {
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+func NewJSONEventSink(out io.Writer) *JSONEventSink {
+	return &JSONEventSink{
+		encoder: json.NewEncoder(out),
+	}
+}
+
+func (jes *JSONEventSink) Emit(event Event) {
+	jes.lock.Lock()
+	defer jes.lock.Unlock()
+
+	jes.encoder.Encode(event)
+}
+
+// ResultEventSink streams events through an EventsProperty on a Coach result.
+//
+// Events are queued, so a slow consumer never blocks the stack action. Up to
+// resultEventBufferSize events are held for the consumer, and any further
+// events are dropped instead of being held in memory for a consumer that may
+// never come, except for failures, which are always kept. Close must be
+// called when the action is done; it reports how many events were dropped
+// as a final warning event, and closes the stream once the queued events
+// have been consumed.
+type ResultEventSink struct {
+	lock    sync.Mutex
+	queued  *sync.Cond
+	queue   []Event
+	events  chan Event
+	closed  bool
+	dropped int
+}
+
+func NewResultEventSink(res *base.Result) *ResultEventSink {
+	sink := &ResultEventSink{
+		queue:  []Event{},
+		events: make(chan Event),
+	}
+	sink.queued = sync.NewCond(&sink.lock)
+
+	eventsProp := &EventsProperty{}
+	eventsProp.Set((<-chan Event)(sink.events))
+	res.AddProperty(eventsProp.Property())
+
+	go sink.forward()
+
+	return sink
+}
+
+func (sink *ResultEventSink) Emit(event Event) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.closed {
+		return
+	}
+	if event.Status != EVENT_STATUS_FAILED && len(sink.queue) >= resultEventBufferSize {
+		sink.dropped++
+		return
+	}
+	sink.queue = append(sink.queue, event)
+	sink.queued.Signal()
+}
+
+// forward passes the queued events to the stream, closing it once the sink is closed and the queue is empty
+func (sink *ResultEventSink) forward() {
+	for {
+		sink.lock.Lock()
+		for len(sink.queue) == 0 && !sink.closed {
+			sink.queued.Wait()
+		}
+		if len(sink.queue) == 0 {
+			sink.lock.Unlock()
+			close(sink.events)
+			return
+		}
+		event := sink.queue[0]
+		sink.queue = sink.queue[1:]
+		sink.lock.Unlock()
+
+		sink.events <- event
+	}
+}
+
+// Dropped is how many events were not streamed, as the queue was full
+func (sink *ResultEventSink) Dropped() int {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.dropped
+}
+
+func (sink *ResultEventSink) Close() {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.closed {
+		return
+	}
+	sink.closed = true
+	if sink.dropped > 0 {
+		sink.queue = append(sink.queue, Event{Kind: RESOURCE_KIND_STACK, Status: EVENT_STATUS_WARNING,
+			Message: fmt.Sprintf("%d stack events were dropped, as they were not consumed in time", sink.dropped)})
+	}
+	sink.queued.Signal()
+}
+
+// EventsProperty holds a stream of stack events, which is closed when the stack action is finished
+type EventsProperty struct {
+	val <-chan Event
+}
+
+func (ep *EventsProperty) Property() api.Property {
+	return api.Property(ep)
+}
+
+func (ep *EventsProperty) Id() string {
+	return PROPERTY_ID_STACK_EVENTS
+}
+
+func (ep *EventsProperty) Type() string {
+	return "<-chan stack.Event"
+}
+
+func (ep *EventsProperty) Ui() api.Ui {
+	return base.NewUi(
+		ep.Id(),
+		"Stack events",
+		"Stream of stack progress events",
+		"",
+	)
+}
+
+func (ep *EventsProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (ep *EventsProperty) Validate() bool {
+	return ep.val != nil
+}
+
+func (ep *EventsProperty) Get() interface{} {
+	return interface{}(ep.val)
+}
+
+func (ep *EventsProperty) Set(val interface{}) error {
+	if typedVal, success := val.(<-chan Event); success {
+		ep.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("EventsProperty expects a <-chan Event value")
+	}
+}
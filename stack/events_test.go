@@ -0,0 +1,55 @@
+package stack
+
+import (
+	"fmt"
+	"testing"
+
+	base "github.com/CoachApplication/base"
+)
+
+func TestResultEventSinkDropsEventsThatAreNotConsumed(t *testing.T) {
+	sink := NewResultEventSink(base.NewResult())
+
+	emitted := resultEventBufferSize + 10
+	for i := 0; i < emitted; i++ {
+		sink.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: "test_web", Status: EVENT_STATUS_INFO})
+	}
+	sink.Close()
+	// events emitted late are ignored instead of panicking on the closed stream
+	sink.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: "test_web", Status: EVENT_STATUS_INFO})
+
+	received := []Event{}
+	for event := range sink.events {
+		received = append(received, event)
+	}
+	if sink.Dropped() == 0 {
+		t.Fatal("No events were dropped")
+	}
+	if len(received)-1+sink.Dropped() != emitted {
+		t.Errorf("Expected %d events to be received or dropped, got %d received and %d dropped", emitted, len(received)-1, sink.Dropped())
+	}
+	last := received[len(received)-1]
+	if last.Status != EVENT_STATUS_WARNING || last.Message != fmt.Sprintf("%d stack events were dropped, as they were not consumed in time", sink.Dropped()) {
+		t.Errorf("The dropped events were not reported: %#v", last)
+	}
+}
+
+func TestResultEventSinkKeepsFailures(t *testing.T) {
+	sink := NewResultEventSink(base.NewResult())
+
+	for i := 0; i < resultEventBufferSize+10; i++ {
+		sink.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: "test_web", Status: EVENT_STATUS_INFO})
+	}
+	sink.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: "test_web", Action: RESOURCE_ACTION_UPDATE, Status: EVENT_STATUS_FAILED, Message: "no such image"})
+	sink.Close()
+
+	failed := 0
+	for event := range sink.events {
+		if event.Status == EVENT_STATUS_FAILED {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected the failure event to be streamed, got %d failures", failed)
+	}
+}
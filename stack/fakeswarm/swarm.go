@@ -0,0 +1,648 @@
+package fakeswarm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	docker_api "github.com/docker/docker/api"
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_filters "github.com/docker/docker/api/types/filters"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_pkg_stdcopy "github.com/docker/docker/pkg/stdcopy"
+)
+
+/**
+ * An in-memory swarm, which implements the client methods that stack
+ * actions use, so that they can be exercised without a docker daemon.
+ *
+ * Objects are kept in a map per kind, keyed by ID, and listing supports
+ * the label and name filters that the stack actions rely on.
+ */
+
+const (
+	METHOD_INFO                    = "Info"
+	METHOD_SERVICE_LIST            = "ServiceList"
+	METHOD_SERVICE_CREATE          = "ServiceCreate"
+	METHOD_SERVICE_UPDATE          = "ServiceUpdate"
+	METHOD_SERVICE_REMOVE          = "ServiceRemove"
+	METHOD_SERVICE_LOGS            = "ServiceLogs"
+	METHOD_TASK_LIST               = "TaskList"
+	METHOD_NODE_LIST               = "NodeList"
+	METHOD_NETWORK_LIST            = "NetworkList"
+	METHOD_NETWORK_CREATE          = "NetworkCreate"
+	METHOD_NETWORK_INSPECT         = "NetworkInspect"
+	METHOD_NETWORK_REMOVE          = "NetworkRemove"
+	METHOD_SECRET_LIST             = "SecretList"
+	METHOD_SECRET_CREATE           = "SecretCreate"
+	METHOD_SECRET_INSPECT_WITH_RAW = "SecretInspectWithRaw"
+	METHOD_SECRET_UPDATE           = "SecretUpdate"
+	METHOD_SECRET_REMOVE           = "SecretRemove"
+)
+
+// Swarm is an in-memory swarm, safe for concurrent use
+type Swarm struct {
+	lock sync.Mutex
+
+	manager     bool
+	autoRun     bool
+	nextId      int
+	clockOffset time.Duration
+
+	services map[string]docker_api_types_swarm.Service
+	networks map[string]docker_api_types.NetworkResource
+	secrets  map[string]docker_api_types_swarm.Secret
+	tasks    map[string]docker_api_types_swarm.Task
+	nodes    map[string]docker_api_types_swarm.Node
+	logs     map[string][]logEntry
+
+	failures map[string]error
+	calls    []string
+}
+
+// NewSwarm provides an empty swarm, as seen from a manager node
+func NewSwarm() *Swarm {
+	return &Swarm{
+		manager:  true,
+		services: map[string]docker_api_types_swarm.Service{},
+		networks: map[string]docker_api_types.NetworkResource{},
+		secrets:  map[string]docker_api_types_swarm.Secret{},
+		tasks:    map[string]docker_api_types_swarm.Task{},
+		nodes:    map[string]docker_api_types_swarm.Node{},
+		logs:     map[string][]logEntry{},
+		failures: map[string]error{},
+	}
+}
+
+/**
+ * Test setup and inspection
+ */
+
+// SetManager sets whether the swarm is seen from a manager node, or from a worker
+func (s *Swarm) SetManager(manager bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.manager = manager
+}
+
+// SetAutoRunTasks makes the swarm start running tasks for services as soon as they are created or updated
+func (s *Swarm) SetAutoRunTasks(autoRun bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.autoRun = autoRun
+}
+
+// SetClockOffset sets how far the daemon clock is ahead of the local clock, as for a daemon on another host
+func (s *Swarm) SetClockOffset(offset time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clockOffset = offset
+}
+
+// FailOn makes every call to a client method fail with err, until it is set back to nil
+func (s *Swarm) FailOn(method string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		delete(s.failures, method)
+	} else {
+		s.failures[method] = err
+	}
+}
+
+// AddNetwork adds a network that was created outside of any stack, and returns its ID
+func (s *Swarm) AddNetwork(network docker_api_types.NetworkResource) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if network.ID == "" {
+		network.ID = s.newId("network")
+	}
+	s.networks[network.ID] = network
+	return network.ID
+}
+
+// AddTask adds a task to the swarm, and returns its ID
+func (s *Swarm) AddTask(task docker_api_types_swarm.Task) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if task.ID == "" {
+		task.ID = s.newId("task")
+	}
+	s.tasks[task.ID] = task
+	return task.ID
+}
+
+// AddNode adds a node to the swarm, and returns its ID
+func (s *Swarm) AddNode(node docker_api_types_swarm.Node) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if node.ID == "" {
+		node.ID = s.newId("node")
+	}
+	s.nodes[node.ID] = node
+	return node.ID
+}
+
+// AddServiceLog adds a line of output from a task to the logs of its service
+func (s *Swarm) AddServiceLog(taskID string, stream docker_pkg_stdcopy.StdType, timestamp time.Time, message string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	task := s.tasks[taskID]
+	s.logs[task.ServiceID] = append(s.logs[task.ServiceID], logEntry{
+		taskID:    taskID,
+		nodeID:    task.NodeID,
+		stream:    stream,
+		timestamp: timestamp,
+		message:   message,
+	})
+}
+
+// SetServiceUpdateStatus sets the update status of a service, as the swarm orchestrator would
+func (s *Swarm) SetServiceUpdateStatus(serviceID string, status *docker_api_types_swarm.UpdateStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if service, found := s.services[serviceID]; found {
+		service.UpdateStatus = status
+		s.services[serviceID] = service
+	}
+}
+
+// Services provides all services, sorted by name
+func (s *Swarm) Services() []docker_api_types_swarm.Service {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	services := []docker_api_types_swarm.Service{}
+	for _, service := range s.services {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Spec.Name < services[j].Spec.Name })
+	return services
+}
+
+// Service provides a service by name
+func (s *Swarm) Service(name string) (docker_api_types_swarm.Service, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, service := range s.services {
+		if service.Spec.Name == name {
+			return service, true
+		}
+	}
+	return docker_api_types_swarm.Service{}, false
+}
+
+// Networks provides all networks, sorted by name
+func (s *Swarm) Networks() []docker_api_types.NetworkResource {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	networks := []docker_api_types.NetworkResource{}
+	for _, network := range s.networks {
+		networks = append(networks, network)
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	return networks
+}
+
+// Secrets provides all secrets, sorted by name
+func (s *Swarm) Secrets() []docker_api_types_swarm.Secret {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	secrets := []docker_api_types_swarm.Secret{}
+	for _, secret := range s.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Spec.Name < secrets[j].Spec.Name })
+	return secrets
+}
+
+// Calls provides the names of the client methods that have been called, in order
+func (s *Swarm) Calls() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.calls...)
+}
+
+// newId generates an ID for a new object; the lock must be held
+func (s *Swarm) newId(kind string) string {
+	s.nextId++
+	return fmt.Sprintf("%s%d", kind, s.nextId)
+}
+
+// call records a client method call, and provides any failure set for it; the lock must be held
+func (s *Swarm) call(method string) error {
+	s.calls = append(s.calls, method)
+	return s.failures[method]
+}
+
+/**
+ * Client methods
+ */
+
+func (s *Swarm) ClientVersion() string {
+	return docker_api.DefaultVersion
+}
+
+func (s *Swarm) Info(ctx context.Context) (docker_api_types.Info, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_INFO); err != nil {
+		return docker_api_types.Info{}, err
+	}
+	return docker_api_types.Info{
+		SystemTime: time.Now().Add(s.clockOffset).Format(time.RFC3339Nano),
+		Swarm: docker_api_types_swarm.Info{
+			LocalNodeState:   docker_api_types_swarm.LocalNodeStateActive,
+			ControlAvailable: s.manager,
+		},
+	}, nil
+}
+
+func (s *Swarm) ServiceList(ctx context.Context, options docker_api_types.ServiceListOptions) ([]docker_api_types_swarm.Service, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SERVICE_LIST); err != nil {
+		return nil, err
+	}
+	services := []docker_api_types_swarm.Service{}
+	for _, service := range s.services {
+		if matches(options.Filters, service.ID, service.Spec.Name, service.Spec.Labels) {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+func (s *Swarm) ServiceCreate(ctx context.Context, service docker_api_types_swarm.ServiceSpec, options docker_api_types.ServiceCreateOptions) (docker_api_types.ServiceCreateResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SERVICE_CREATE); err != nil {
+		return docker_api_types.ServiceCreateResponse{}, err
+	}
+	for _, existing := range s.services {
+		if existing.Spec.Name == service.Name {
+			return docker_api_types.ServiceCreateResponse{}, fmt.Errorf("Error response from daemon: rpc error: name conflicts with an existing object")
+		}
+	}
+	id := s.newId("service")
+	s.services[id] = docker_api_types_swarm.Service{
+		ID:   id,
+		Meta: docker_api_types_swarm.Meta{Version: docker_api_types_swarm.Version{Index: 1}},
+		Spec: service,
+	}
+	s.runTasks(id, service)
+	return docker_api_types.ServiceCreateResponse{ID: id}, nil
+}
+
+func (s *Swarm) ServiceUpdate(ctx context.Context, serviceID string, version docker_api_types_swarm.Version, service docker_api_types_swarm.ServiceSpec, options docker_api_types.ServiceUpdateOptions) (docker_api_types.ServiceUpdateResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SERVICE_UPDATE); err != nil {
+		return docker_api_types.ServiceUpdateResponse{}, err
+	}
+	existing, found := s.services[serviceID]
+	if !found {
+		return docker_api_types.ServiceUpdateResponse{}, notFoundError{kind: "service", id: serviceID}
+	}
+	if existing.Version.Index != version.Index {
+		return docker_api_types.ServiceUpdateResponse{}, fmt.Errorf("Error response from daemon: rpc error: update out of sequence")
+	}
+	previous := existing.Spec
+	existing.PreviousSpec = &previous
+	existing.Spec = service
+	existing.Version.Index++
+	s.services[serviceID] = existing
+	s.runTasks(serviceID, service)
+	return docker_api_types.ServiceUpdateResponse{}, nil
+}
+
+func (s *Swarm) ServiceRemove(ctx context.Context, serviceID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SERVICE_REMOVE); err != nil {
+		return err
+	}
+	if _, found := s.services[serviceID]; !found {
+		return notFoundError{kind: "service", id: serviceID}
+	}
+	delete(s.services, serviceID)
+	// tasks of a removed service are shut down
+	for id, task := range s.tasks {
+		if task.ServiceID == serviceID {
+			task.Status.State = docker_api_types_swarm.TaskStateShutdown
+			s.tasks[id] = task
+		}
+	}
+	return nil
+}
+
+// ServiceLogs provides the logs added to a service, multiplexed like the daemon does unless the service has a TTY; following the logs ends with the lines already added
+func (s *Swarm) ServiceLogs(ctx context.Context, serviceID string, options docker_api_types.ContainerLogsOptions) (io.ReadCloser, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SERVICE_LOGS); err != nil {
+		return nil, err
+	}
+	service, found := s.services[serviceID]
+	if !found {
+		return nil, notFoundError{kind: "service", id: serviceID}
+	}
+
+	entries := s.logs[serviceID]
+	if tail, err := strconv.Atoi(options.Tail); err == nil && tail < len(entries) {
+		entries = entries[len(entries)-tail:]
+	}
+
+	body := &bytes.Buffer{}
+	for _, entry := range entries {
+		if (entry.stream == docker_pkg_stdcopy.Stdout && !options.ShowStdout) || (entry.stream == docker_pkg_stdcopy.Stderr && !options.ShowStderr) {
+			continue
+		}
+
+		line := entry.message + "\n"
+		if options.Details {
+			line = fmt.Sprintf("com.docker.swarm.node.id=%s,com.docker.swarm.service.id=%s,com.docker.swarm.task.id=%s %s", entry.nodeID, serviceID, entry.taskID, line)
+		}
+		if options.Timestamps {
+			line = entry.timestamp.Format(time.RFC3339Nano) + " " + line
+		}
+
+		if service.Spec.TaskTemplate.ContainerSpec.TTY {
+			body.WriteString(line)
+		} else {
+			docker_pkg_stdcopy.NewStdWriter(body, entry.stream).Write([]byte(line))
+		}
+	}
+	return ioutil.NopCloser(body), nil
+}
+
+func (s *Swarm) TaskList(ctx context.Context, options docker_api_types.TaskListOptions) ([]docker_api_types_swarm.Task, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_TASK_LIST); err != nil {
+		return nil, err
+	}
+	tasks := []docker_api_types_swarm.Task{}
+	for _, task := range s.tasks {
+		if !options.Filters.ExactMatch("service", task.ServiceID) ||
+			!options.Filters.ExactMatch("desired-state", string(task.DesiredState)) ||
+			!options.Filters.ExactMatch("node", task.NodeID) {
+			continue
+		}
+		if matches(options.Filters, task.ID, task.Name, task.Labels) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *Swarm) NodeList(ctx context.Context, options docker_api_types.NodeListOptions) ([]docker_api_types_swarm.Node, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_NODE_LIST); err != nil {
+		return nil, err
+	}
+	nodes := []docker_api_types_swarm.Node{}
+	for _, node := range s.nodes {
+		if matches(options.Filters, node.ID, node.Description.Hostname, node.Spec.Labels) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (s *Swarm) NetworkList(ctx context.Context, options docker_api_types.NetworkListOptions) ([]docker_api_types.NetworkResource, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_NETWORK_LIST); err != nil {
+		return nil, err
+	}
+	networks := []docker_api_types.NetworkResource{}
+	for _, network := range s.networks {
+		if matches(options.Filters, network.ID, network.Name, network.Labels) {
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+func (s *Swarm) NetworkCreate(ctx context.Context, name string, options docker_api_types.NetworkCreate) (docker_api_types.NetworkCreateResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_NETWORK_CREATE); err != nil {
+		return docker_api_types.NetworkCreateResponse{}, err
+	}
+	for _, existing := range s.networks {
+		if existing.Name == name {
+			return docker_api_types.NetworkCreateResponse{}, fmt.Errorf("Error response from daemon: network with name %s already exists", name)
+		}
+	}
+	scope := "local"
+	if options.Driver == "overlay" {
+		scope = "swarm"
+	}
+	id := s.newId("network")
+	s.networks[id] = docker_api_types.NetworkResource{
+		Name:       name,
+		ID:         id,
+		Scope:      scope,
+		Driver:     options.Driver,
+		Internal:   options.Internal,
+		Attachable: options.Attachable,
+		Options:    options.Options,
+		Labels:     options.Labels,
+	}
+	return docker_api_types.NetworkCreateResponse{ID: id}, nil
+}
+
+func (s *Swarm) NetworkInspect(ctx context.Context, networkID string, verbose bool) (docker_api_types.NetworkResource, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_NETWORK_INSPECT); err != nil {
+		return docker_api_types.NetworkResource{}, err
+	}
+	for _, network := range s.networks {
+		if network.ID == networkID || network.Name == networkID {
+			return network, nil
+		}
+	}
+	return docker_api_types.NetworkResource{}, notFoundError{kind: "network", id: networkID}
+}
+
+func (s *Swarm) NetworkRemove(ctx context.Context, networkID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_NETWORK_REMOVE); err != nil {
+		return err
+	}
+	if _, found := s.networks[networkID]; !found {
+		return notFoundError{kind: "network", id: networkID}
+	}
+	delete(s.networks, networkID)
+	return nil
+}
+
+func (s *Swarm) SecretList(ctx context.Context, options docker_api_types.SecretListOptions) ([]docker_api_types_swarm.Secret, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SECRET_LIST); err != nil {
+		return nil, err
+	}
+	secrets := []docker_api_types_swarm.Secret{}
+	for _, secret := range s.secrets {
+		if matches(options.Filters, secret.ID, secret.Spec.Name, secret.Spec.Labels) {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets, nil
+}
+
+func (s *Swarm) SecretCreate(ctx context.Context, secret docker_api_types_swarm.SecretSpec) (docker_api_types.SecretCreateResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SECRET_CREATE); err != nil {
+		return docker_api_types.SecretCreateResponse{}, err
+	}
+	for _, existing := range s.secrets {
+		if existing.Spec.Name == secret.Name {
+			return docker_api_types.SecretCreateResponse{}, fmt.Errorf("Error response from daemon: rpc error: secret %s already exists", secret.Name)
+		}
+	}
+	id := s.newId("secret")
+	s.secrets[id] = docker_api_types_swarm.Secret{
+		ID:   id,
+		Meta: docker_api_types_swarm.Meta{Version: docker_api_types_swarm.Version{Index: 1}},
+		Spec: secret,
+	}
+	return docker_api_types.SecretCreateResponse{ID: id}, nil
+}
+
+func (s *Swarm) SecretInspectWithRaw(ctx context.Context, name string) (docker_api_types_swarm.Secret, []byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SECRET_INSPECT_WITH_RAW); err != nil {
+		return docker_api_types_swarm.Secret{}, nil, err
+	}
+	for _, secret := range s.secrets {
+		if secret.ID == name || secret.Spec.Name == name {
+			return secret, nil, nil
+		}
+	}
+	return docker_api_types_swarm.Secret{}, nil, notFoundError{kind: "secret", id: name}
+}
+
+func (s *Swarm) SecretUpdate(ctx context.Context, id string, version docker_api_types_swarm.Version, secret docker_api_types_swarm.SecretSpec) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SECRET_UPDATE); err != nil {
+		return err
+	}
+	existing, found := s.secrets[id]
+	if !found {
+		return notFoundError{kind: "secret", id: id}
+	}
+	if existing.Version.Index != version.Index {
+		return fmt.Errorf("Error response from daemon: rpc error: update out of sequence")
+	}
+	// like swarm, only the labels of a secret can be updated, and the update can't carry data
+	if secret.Name != existing.Spec.Name || secret.Data != nil {
+		return fmt.Errorf("Error response from daemon: rpc error: only updates to Labels are allowed")
+	}
+	existing.Spec.Labels = secret.Labels
+	existing.Version.Index++
+	s.secrets[id] = existing
+	return nil
+}
+
+func (s *Swarm) SecretRemove(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(METHOD_SECRET_REMOVE); err != nil {
+		return err
+	}
+	secret, found := s.secrets[id]
+	if !found {
+		return notFoundError{kind: "secret", id: id}
+	}
+	// like swarm, a secret can't be removed while a service spec refers to it
+	for _, service := range s.services {
+		for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+			if ref.SecretID == id {
+				return fmt.Errorf("Error response from daemon: rpc error: secret '%s' is in use by the following service: %s", secret.Spec.Name, service.Spec.Name)
+			}
+		}
+	}
+	delete(s.secrets, id)
+	return nil
+}
+
+/**
+ * Helpers
+ */
+
+// runTasks replaces the running tasks of a service with new running tasks, if tasks are run automatically; the lock must be held
+func (s *Swarm) runTasks(serviceID string, service docker_api_types_swarm.ServiceSpec) {
+	if !s.autoRun {
+		return
+	}
+
+	for id, task := range s.tasks {
+		if task.ServiceID == serviceID && task.DesiredState == docker_api_types_swarm.TaskStateRunning {
+			task.DesiredState = docker_api_types_swarm.TaskStateShutdown
+			task.Status.State = docker_api_types_swarm.TaskStateShutdown
+			s.tasks[id] = task
+		}
+	}
+
+	replicas := uint64(1)
+	if service.Mode.Replicated != nil && service.Mode.Replicated.Replicas != nil {
+		replicas = *service.Mode.Replicated.Replicas
+	}
+	for slot := 1; slot <= int(replicas); slot++ {
+		id := s.newId("task")
+		s.tasks[id] = docker_api_types_swarm.Task{
+			ID:           id,
+			Annotations:  docker_api_types_swarm.Annotations{Labels: service.Labels},
+			Spec:         service.TaskTemplate,
+			ServiceID:    serviceID,
+			Slot:         slot,
+			DesiredState: docker_api_types_swarm.TaskStateRunning,
+			Status:       docker_api_types_swarm.TaskStatus{State: docker_api_types_swarm.TaskStateRunning},
+		}
+	}
+}
+
+// matches applies the id, name and label filters that the daemon supports for swarm objects
+func matches(filters docker_api_types_filters.Args, id, name string, labels map[string]string) bool {
+	return filters.ExactMatch("id", id) &&
+		filters.FuzzyMatch("name", name) &&
+		filters.MatchKVList("label", labels)
+}
+
+// logEntry is a line of output from a task
+type logEntry struct {
+	taskID    string
+	nodeID    string
+	stream    docker_pkg_stdcopy.StdType
+	timestamp time.Time
+	message   string
+}
+
+// notFoundError is recognised by docker_client.IsErrNotFound, like the errors of the real client
+type notFoundError struct {
+	kind string
+	id   string
+}
+
+func (e notFoundError) Error() string {
+	return fmt.Sprintf("Error: No such %s: %s", e.kind, e.id)
+}
+
+func (e notFoundError) NotFound() bool {
+	return true
+}
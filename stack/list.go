@@ -0,0 +1,126 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+const (
+	PROPERTY_ID_STACK_STACKS = "stack.stacks"
+)
+
+// StackSummary counts the resources of a stack deployed on the swarm
+type StackSummary struct {
+	Namespace    string `json:"namespace"`
+	Services     int    `json:"services"`
+	Networks     int    `json:"networks"`
+	Secrets      int    `json:"secrets"`
+	RunningTasks int    `json:"runningTasks"`
+	DesiredTasks int    `json:"desiredTasks"`
+}
+
+// runList summarises every stack on the swarm, sorted by namespace
+func runList(ctx context.Context, client StackClient) ([]StackSummary, error) {
+	filter := getAllStacksFilter()
+
+	services, err := client.ServiceList(ctx, docker_api_types.ServiceListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+	networks, err := client.NetworkList(ctx, docker_api_types.NetworkListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := client.SecretList(ctx, docker_api_types.SecretListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := client.TaskList(ctx, docker_api_types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	stacks := map[string]*StackSummary{}
+	stack := func(labels map[string]string) *StackSummary {
+		namespace := labels[docker_cli_compose_convert.LabelNamespace]
+		if _, found := stacks[namespace]; !found {
+			stacks[namespace] = &StackSummary{Namespace: namespace}
+		}
+		return stacks[namespace]
+	}
+
+	counts := serviceTaskCounts(services, tasks, nil)
+	for _, service := range services {
+		summary := stack(service.Spec.Labels)
+		summary.Services++
+		summary.RunningTasks += counts[service.ID].running
+		summary.DesiredTasks += counts[service.ID].desired
+	}
+	for _, network := range networks {
+		stack(network.Labels).Networks++
+	}
+	for _, secret := range secrets {
+		stack(secret.Spec.Labels).Secrets++
+	}
+
+	summaries := []StackSummary{}
+	for _, summary := range stacks {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Namespace < summaries[j].Namespace })
+	return summaries, nil
+}
+
+// StacksProperty holds a summary of every stack on the swarm
+type StacksProperty struct {
+	val []StackSummary
+}
+
+func (sp *StacksProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *StacksProperty) Id() string {
+	return PROPERTY_ID_STACK_STACKS
+}
+
+func (sp *StacksProperty) Type() string {
+	return "[]stack.StackSummary"
+}
+
+func (sp *StacksProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Stacks",
+		"Every stack on the swarm, with counts of its services, networks, secrets and tasks",
+		"",
+	)
+}
+
+func (sp *StacksProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (sp *StacksProperty) Validate() bool {
+	return sp.val != nil
+}
+
+func (sp *StacksProperty) Get() interface{} {
+	return interface{}(sp.val)
+}
+
+func (sp *StacksProperty) Set(val interface{}) error {
+	if typedVal, success := val.([]StackSummary); success {
+		sp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("StacksProperty expects a []StackSummary value")
+	}
+}
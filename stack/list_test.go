@@ -0,0 +1,56 @@
+package stack
+
+import (
+	"context"
+	"testing"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func TestRunListSummarisesEachStack(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	swarm.SetAutoRunTasks(true)
+	front := docker_cli_compose_convert.NewNamespace("front")
+	back := docker_cli_compose_convert.NewNamespace("back")
+
+	replicas := uint64(3)
+	web := testServiceSpec(front, "web", "nginx")
+	web.Mode.Replicated = &docker_api_types_swarm.ReplicatedService{Replicas: &replicas}
+	agent := testServiceSpec(front, "agent", "agent")
+	agent.Mode = docker_api_types_swarm.ServiceMode{Global: &docker_api_types_swarm.GlobalService{}}
+	unlabelled := docker_api_types_swarm.ServiceSpec{Annotations: docker_api_types_swarm.Annotations{Name: "loose"}}
+	for _, spec := range []docker_api_types_swarm.ServiceSpec{web, agent, testServiceSpec(back, "db", "postgres"), unlabelled} {
+		if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "front_default", Labels: docker_cli_compose_convert.AddStackLabel(front, nil)})
+	if _, err := swarm.SecretCreate(ctx, docker_api_types_swarm.SecretSpec{
+		Annotations: docker_api_types_swarm.Annotations{Name: "back_token", Labels: docker_cli_compose_convert.AddStackLabel(back, nil)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stacks, err := runList(ctx, swarm)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %s", err)
+	}
+
+	expected := []StackSummary{
+		{Namespace: "back", Services: 1, Secrets: 1, RunningTasks: 1, DesiredTasks: 1},
+		{Namespace: "front", Services: 2, Networks: 1, RunningTasks: 4, DesiredTasks: 4},
+	}
+	if len(stacks) != len(expected) {
+		t.Fatalf("Expected %d stacks, got: %#v", len(expected), stacks)
+	}
+	for i, stack := range stacks {
+		if stack != expected[i] {
+			t.Errorf("Expected stack summary %#v, got %#v", expected[i], stack)
+		}
+	}
+}
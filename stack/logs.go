@@ -0,0 +1,538 @@
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+	docker_pkg_stdcopy "github.com/docker/docker/pkg/stdcopy"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+/**
+ * Logs are streamed from every service of a stack at once, like "docker
+ * service logs". Each log line comes with details that name the task it
+ * came from, which are used to prefix the line with the task slot.
+ *
+ * Services with a TTY have no details, or separate stderr, so their lines
+ * can only be attributed to the service.
+ */
+
+const (
+	LOG_STREAM_STDOUT = "stdout"
+	LOG_STREAM_STDERR = "stderr"
+
+	PROPERTY_ID_STACK_LOGS = "stack.logs"
+
+	defaultLogTail = "all"
+
+	resultLogBufferSize = 4096
+)
+
+type logsOptions struct {
+	namespace  string
+	service    string
+	follow     bool
+	since      string
+	tail       string
+	timestamps bool
+}
+
+// newLogsOptionsDefault provides logs options for the stack in the current directory
+func newLogsOptionsDefault() logsOptions {
+	wd, _ := os.Getwd()
+	return newLogsOptionsForProject(wd)
+}
+
+// newLogsOptionsForProject provides logs options for the stack of a project
+func newLogsOptionsForProject(projectRoot string) logsOptions {
+	return logsOptions{
+		namespace: namespaceFromPath(projectRoot),
+		tail:      defaultLogTail,
+	}
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts logsOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	namespaceProp := &NamespaceProperty{}
+	namespaceProp.Set(opts.namespace)
+	props.Add(namespaceProp.Property())
+
+	serviceProp := &ServiceProperty{}
+	serviceProp.Set(opts.service)
+	props.Add(serviceProp.Property())
+
+	followProp := &FollowProperty{}
+	followProp.Set(opts.follow)
+	props.Add(followProp.Property())
+
+	sinceProp := &SinceProperty{}
+	sinceProp.Set(opts.since)
+	props.Add(sinceProp.Property())
+
+	tailProp := &TailProperty{}
+	tailProp.Set(opts.tail)
+	props.Add(tailProp.Property())
+
+	timestampsProp := &TimestampsProperty{}
+	timestampsProp.Set(opts.timestamps)
+	props.Add(timestampsProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts logsOptions) withProperties(props api.Properties) logsOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_NAMESPACE); ok {
+		opts.namespace = val
+	}
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_SERVICE); ok {
+		opts.service = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_FOLLOW); ok {
+		opts.follow = val
+	}
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_SINCE); ok {
+		opts.since = val
+	}
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_TAIL); ok {
+		opts.tail = val
+	}
+	if val, ok := propertyBool(props, PROPERTY_ID_STACK_TIMESTAMPS); ok {
+		opts.timestamps = val
+	}
+	return opts
+}
+
+// validate checks that the options describe a stack
+func (opts logsOptions) validate() []error {
+	errs := []error{}
+
+	if err := validateNamespace(opts.namespace); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// LogLine is a single line of output from a task of a stack service
+type LogLine struct {
+	Service   string    `json:"service"`
+	Slot      int       `json:"slot,omitempty"`
+	TaskID    string    `json:"taskId,omitempty"`
+	NodeID    string    `json:"nodeId,omitempty"`
+	Stream    string    `json:"stream"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// Prefix names where the line came from, like "docker service logs" does
+func (line LogLine) Prefix() string {
+	if line.Slot == 0 {
+		return line.Service
+	}
+	return fmt.Sprintf("%s.%d", line.Service, line.Slot)
+}
+
+// LogSink receives log lines, possibly from a number of services at once
+type LogSink interface {
+	Log(line LogLine)
+}
+
+// runLogs streams the logs of the stack services, or of a single service, until they end or the context is cancelled
+func runLogs(ctx context.Context, client StackClient, logs LogSink, opts logsOptions) error {
+	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
+
+	services, err := getStackServices(ctx, client, opts.namespace)
+	if err != nil {
+		return newResourceError(RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	if opts.service != "" {
+		name := namespace.Scope(opts.service)
+		selected := []docker_api_types_swarm.Service{}
+		for _, service := range services {
+			if service.Spec.Name == name {
+				selected = append(selected, service)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("Service %s is not part of stack %s", opts.service, opts.namespace)
+		}
+		services = selected
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("Nothing found in stack: %s", opts.namespace)
+	}
+
+	slots := newTaskSlots(client, opts.namespace)
+	// lines from different services are interleaved, but never mixed up
+	logs = &lockedLogSink{logs: logs}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(services))
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service docker_api_types_swarm.Service) {
+			defer wg.Done()
+			if err := streamServiceLogs(ctx, client, logs, service, slots, opts); err != nil {
+				errs[i] = newResourceError(RESOURCE_KIND_SERVICE, service.Spec.Name, RESOURCE_ACTION_LOGS, err)
+			}
+		}(i, service)
+	}
+	wg.Wait()
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return errorsOrNil(failed)
+}
+
+func streamServiceLogs(ctx context.Context, client StackClient, logs LogSink, service docker_api_types_swarm.Service, slots *taskSlots, opts logsOptions) error {
+	tty := service.Spec.TaskTemplate.ContainerSpec.TTY
+
+	body, err := client.ServiceLogs(ctx, service.ID, docker_api_types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      opts.since,
+		Timestamps: opts.timestamps,
+		Follow:     opts.follow,
+		Tail:       opts.tail,
+		// a TTY log would get the details written into its lines
+		Details: !tty,
+	})
+	if err != nil {
+		// logs that were stopped before they started have not failed
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+
+	stdout := &logLineWriter{ctx: ctx, logs: logs, service: service.Spec.Name, stream: LOG_STREAM_STDOUT, details: !tty, timestamps: opts.timestamps, slots: slots}
+	stderr := &logLineWriter{ctx: ctx, logs: logs, service: service.Spec.Name, stream: LOG_STREAM_STDERR, details: !tty, timestamps: opts.timestamps, slots: slots}
+
+	if tty {
+		_, err = io.Copy(stdout, body)
+	} else {
+		_, err = docker_pkg_stdcopy.StdCopy(stdout, stderr, body)
+	}
+	stdout.flush()
+	stderr.flush()
+
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// logLineWriter splits a demultiplexed log stream into lines, and parses the timestamp and details that prefix each line
+type logLineWriter struct {
+	ctx        context.Context
+	logs       LogSink
+	service    string
+	stream     string
+	details    bool
+	timestamps bool
+	slots      *taskSlots
+
+	buffer []byte
+}
+
+func (llw *logLineWriter) Write(p []byte) (int, error) {
+	llw.buffer = append(llw.buffer, p...)
+	for {
+		end := bytes.IndexByte(llw.buffer, '\n')
+		if end < 0 {
+			break
+		}
+		llw.writeLine(string(llw.buffer[:end]))
+		llw.buffer = llw.buffer[end+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes out a last line that was not terminated
+func (llw *logLineWriter) flush() {
+	if len(llw.buffer) > 0 {
+		llw.writeLine(string(llw.buffer))
+		llw.buffer = nil
+	}
+}
+
+func (llw *logLineWriter) writeLine(text string) {
+	line := LogLine{Service: llw.service, Stream: llw.stream}
+
+	if llw.timestamps {
+		parts := strings.SplitN(text, " ", 2)
+		if timestamp, err := time.Parse(time.RFC3339Nano, parts[0]); err == nil && len(parts) == 2 {
+			line.Timestamp = timestamp
+			text = parts[1]
+		}
+	}
+	if llw.details {
+		parts := strings.SplitN(text, " ", 2)
+		if details, ok := parseLogDetails(parts[0]); ok {
+			line.TaskID = details["com.docker.swarm.task.id"]
+			line.NodeID = details["com.docker.swarm.node.id"]
+			line.Slot = llw.slots.slot(llw.ctx, line.TaskID)
+			text = ""
+			if len(parts) == 2 {
+				text = parts[1]
+			}
+		}
+	}
+	line.Message = strings.TrimSuffix(text, "\r")
+
+	llw.logs.Log(line)
+}
+
+// parseLogDetails parses the comma separated key=value details that swarm adds to service logs
+func parseLogDetails(input string) (map[string]string, bool) {
+	details := map[string]string{}
+	for _, component := range strings.Split(input, ",") {
+		parts := strings.SplitN(component, "=", 2)
+		if len(parts) != 2 {
+			return nil, false
+		}
+		details[parts[0]] = parts[1]
+	}
+	_, found := details["com.docker.swarm.task.id"]
+	return details, found
+}
+
+// taskSlots looks up the slots of stack tasks, listing the tasks again when a new task shows up
+type taskSlots struct {
+	client    StackClient
+	namespace string
+
+	lock  sync.Mutex
+	slots map[string]int
+}
+
+func newTaskSlots(client StackClient, namespace string) *taskSlots {
+	return &taskSlots{
+		client:    client,
+		namespace: namespace,
+		slots:     map[string]int{},
+	}
+}
+
+func (ts *taskSlots) slot(ctx context.Context, taskID string) int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if slot, found := ts.slots[taskID]; found {
+		return slot
+	}
+	if tasks, err := getStackTasks(ctx, ts.client, ts.namespace); err == nil {
+		for _, task := range tasks {
+			ts.slots[task.ID] = task.Slot
+		}
+	}
+	// global tasks have no slot, and unknown tasks aren't looked up again
+	if _, found := ts.slots[taskID]; !found {
+		ts.slots[taskID] = 0
+	}
+	return ts.slots[taskID]
+}
+
+type lockedLogSink struct {
+	lock sync.Mutex
+	logs LogSink
+}
+
+func (lls *lockedLogSink) Log(line LogLine) {
+	lls.lock.Lock()
+	defer lls.lock.Unlock()
+	lls.logs.Log(line)
+}
+
+// MultiLogSink passes log lines to a number of sinks
+type MultiLogSink []LogSink
+
+func (mls MultiLogSink) Log(line LogLine) {
+	for _, sink := range mls {
+		if sink != nil {
+			sink.Log(line)
+		}
+	}
+}
+
+// WriterLogSink writes log lines prefixed with their task, like "docker service logs"
+type WriterLogSink struct {
+	out io.Writer
+	err io.Writer
+}
+
+func NewWriterLogSink(out, err io.Writer) *WriterLogSink {
+	return &WriterLogSink{
+		out: out,
+		err: err,
+	}
+}
+
+func (wls *WriterLogSink) Log(line LogLine) {
+	w := wls.out
+	if line.Stream == LOG_STREAM_STDERR {
+		w = wls.err
+	}
+	if line.Timestamp.IsZero() {
+		fmt.Fprintf(w, "%s | %s\n", line.Prefix(), line.Message)
+	} else {
+		fmt.Fprintf(w, "%s %s | %s\n", line.Timestamp.Format(time.RFC3339Nano), line.Prefix(), line.Message)
+	}
+}
+
+// ResultLogSink streams log lines through a LogsProperty on a Coach result.
+//
+// Like the ResultEventSink, lines are queued so that a slow consumer never
+// blocks the logs, and once resultLogBufferSize lines are waiting any
+// further lines are dropped until the consumer catches up, so following
+// logs for a result nobody reads does not grow without limit. Close must be
+// called once the logs have ended; it reports how many lines were dropped as
+// a final stderr line, and closes the stream once the queued lines have been
+// consumed.
+type ResultLogSink struct {
+	lock    sync.Mutex
+	queued  *sync.Cond
+	queue   []LogLine
+	lines   chan LogLine
+	closed  bool
+	dropped int
+}
+
+func NewResultLogSink(res *base.Result) *ResultLogSink {
+	sink := &ResultLogSink{
+		queue: []LogLine{},
+		lines: make(chan LogLine),
+	}
+	sink.queued = sync.NewCond(&sink.lock)
+
+	logsProp := &LogsProperty{}
+	logsProp.Set((<-chan LogLine)(sink.lines))
+	res.AddProperty(logsProp.Property())
+
+	go sink.forward()
+
+	return sink
+}
+
+func (sink *ResultLogSink) Log(line LogLine) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.closed {
+		return
+	}
+	if len(sink.queue) >= resultLogBufferSize {
+		sink.dropped++
+		return
+	}
+	sink.queue = append(sink.queue, line)
+	sink.queued.Signal()
+}
+
+// forward passes the queued lines to the stream, closing it once the sink is closed and the queue is empty
+func (sink *ResultLogSink) forward() {
+	for {
+		sink.lock.Lock()
+		for len(sink.queue) == 0 && !sink.closed {
+			sink.queued.Wait()
+		}
+		if len(sink.queue) == 0 {
+			sink.lock.Unlock()
+			close(sink.lines)
+			return
+		}
+		line := sink.queue[0]
+		sink.queue = sink.queue[1:]
+		sink.lock.Unlock()
+
+		sink.lines <- line
+	}
+}
+
+// Dropped is how many log lines were not streamed, as the queue was full
+func (sink *ResultLogSink) Dropped() int {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.dropped
+}
+
+func (sink *ResultLogSink) Close() {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.closed {
+		return
+	}
+	sink.closed = true
+	if sink.dropped > 0 {
+		sink.queue = append(sink.queue, LogLine{Stream: LOG_STREAM_STDERR,
+			Message: fmt.Sprintf("%d log lines were dropped, as they were not consumed in time", sink.dropped)})
+	}
+	sink.queued.Signal()
+}
+
+// LogsProperty holds a stream of stack log lines, which is closed when the logs have ended
+type LogsProperty struct {
+	val <-chan LogLine
+}
+
+func (lp *LogsProperty) Property() api.Property {
+	return api.Property(lp)
+}
+
+func (lp *LogsProperty) Id() string {
+	return PROPERTY_ID_STACK_LOGS
+}
+
+func (lp *LogsProperty) Type() string {
+	return "<-chan stack.LogLine"
+}
+
+func (lp *LogsProperty) Ui() api.Ui {
+	return base.NewUi(
+		lp.Id(),
+		"Stack logs",
+		"Stream of log lines from the stack services",
+		"",
+	)
+}
+
+func (lp *LogsProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (lp *LogsProperty) Validate() bool {
+	return lp.val != nil
+}
+
+func (lp *LogsProperty) Get() interface{} {
+	return interface{}(lp.val)
+}
+
+func (lp *LogsProperty) Set(val interface{}) error {
+	if typedVal, success := val.(<-chan LogLine); success {
+		lp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("LogsProperty expects a <-chan LogLine value")
+	}
+}
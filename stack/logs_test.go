@@ -0,0 +1,186 @@
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	base "github.com/CoachApplication/base"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+	docker_pkg_stdcopy "github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+// recordingLogSink keeps all log lines, so that tests can check what was streamed
+type recordingLogSink struct {
+	lock  sync.Mutex
+	lines []LogLine
+}
+
+func (rls *recordingLogSink) Log(line LogLine) {
+	rls.lock.Lock()
+	defer rls.lock.Unlock()
+	rls.lines = append(rls.lines, line)
+}
+
+// formatted provides the lines as "prefix stream message", sorted as services are streamed in parallel
+func (rls *recordingLogSink) formatted() []string {
+	rls.lock.Lock()
+	defer rls.lock.Unlock()
+	formatted := []string{}
+	for _, line := range rls.lines {
+		formatted = append(formatted, line.Prefix()+" "+line.Stream+" "+line.Message)
+	}
+	sort.Strings(formatted)
+	return formatted
+}
+
+// createLoggingService creates a service with a task in each of the slots, and provides the task IDs
+func createLoggingService(t *testing.T, swarm *fakeswarm.Swarm, spec docker_api_types_swarm.ServiceSpec, slots int) []string {
+	created, err := swarm.ServiceCreate(context.Background(), spec, docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskIds := []string{}
+	for slot := 1; slot <= slots; slot++ {
+		taskIds = append(taskIds, swarm.AddTask(docker_api_types_swarm.Task{
+			Annotations:  docker_api_types_swarm.Annotations{Labels: spec.Labels},
+			ServiceID:    created.ID,
+			Slot:         slot,
+			DesiredState: docker_api_types_swarm.TaskStateRunning,
+		}))
+	}
+	return taskIds
+}
+
+func TestRunLogsPrefixesLinesWithTheirTask(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	webTasks := createLoggingService(t, swarm, testServiceSpec(namespace, "web", "nginx"), 2)
+	dbTasks := createLoggingService(t, swarm, testServiceSpec(namespace, "db", "postgres"), 1)
+	now := time.Now()
+	swarm.AddServiceLog(webTasks[0], docker_pkg_stdcopy.Stdout, now, "GET /")
+	swarm.AddServiceLog(webTasks[1], docker_pkg_stdcopy.Stderr, now, "upstream timed out")
+	swarm.AddServiceLog(dbTasks[0], docker_pkg_stdcopy.Stdout, now, "ready to accept connections")
+
+	logs := &recordingLogSink{}
+	opts := newLogsOptionsForProject("test")
+	if err := runLogs(context.Background(), swarm, logs, opts); err != nil {
+		t.Fatalf("Unexpected logs error: %s", err)
+	}
+
+	expected := []string{
+		"test_db.1 stdout ready to accept connections",
+		"test_web.1 stdout GET /",
+		"test_web.2 stderr upstream timed out",
+	}
+	if formatted := logs.formatted(); !reflect.DeepEqual(formatted, expected) {
+		t.Errorf("Expected log lines %v, got %v", expected, formatted)
+	}
+}
+
+func TestRunLogsForASingleService(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	webTasks := createLoggingService(t, swarm, testServiceSpec(namespace, "web", "nginx"), 1)
+	dbTasks := createLoggingService(t, swarm, testServiceSpec(namespace, "db", "postgres"), 1)
+	timestamp := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	swarm.AddServiceLog(webTasks[0], docker_pkg_stdcopy.Stdout, timestamp, "first")
+	swarm.AddServiceLog(webTasks[0], docker_pkg_stdcopy.Stdout, timestamp, "second")
+	swarm.AddServiceLog(dbTasks[0], docker_pkg_stdcopy.Stdout, timestamp, "ignored")
+
+	logs := &recordingLogSink{}
+	opts := newLogsOptionsForProject("test")
+	opts.service = "web"
+	opts.tail = "1"
+	opts.timestamps = true
+	if err := runLogs(context.Background(), swarm, logs, opts); err != nil {
+		t.Fatalf("Unexpected logs error: %s", err)
+	}
+
+	if len(logs.lines) != 1 {
+		t.Fatalf("Expected only the last line of the web service, got %v", logs.formatted())
+	}
+	line := logs.lines[0]
+	if line.Message != "second" || line.TaskID != webTasks[0] || !line.Timestamp.Equal(timestamp) {
+		t.Errorf("The log line was not parsed: %#v", line)
+	}
+
+	opts.service = "cache"
+	if err := runLogs(context.Background(), swarm, logs, opts); err == nil {
+		t.Error("Logs of a service that is not part of the stack were streamed")
+	}
+}
+
+func TestRunLogsCopiesTTYOutput(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	spec := testServiceSpec(namespace, "console", "busybox")
+	spec.TaskTemplate.ContainerSpec.TTY = true
+	tasks := createLoggingService(t, swarm, spec, 1)
+	swarm.AddServiceLog(tasks[0], docker_pkg_stdcopy.Stdout, time.Now(), "$ ls")
+
+	out := &bytes.Buffer{}
+	if err := runLogs(context.Background(), swarm, NewWriterLogSink(out, out), newLogsOptionsForProject("test")); err != nil {
+		t.Fatalf("Unexpected logs error: %s", err)
+	}
+
+	if expected := "test_console | $ ls\n"; out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestResultLogSinkDropsLinesThatAreNotConsumed(t *testing.T) {
+	sink := NewResultLogSink(base.NewResult())
+
+	logged := resultLogBufferSize + 5
+	for i := 0; i < logged; i++ {
+		sink.Log(LogLine{Service: "test_web", Stream: LOG_STREAM_STDOUT, Message: "line"})
+	}
+	sink.Close()
+	sink.Log(LogLine{Service: "test_web", Stream: LOG_STREAM_STDOUT, Message: "late"})
+
+	received := []LogLine{}
+	for line := range sink.lines {
+		received = append(received, line)
+	}
+	if sink.Dropped() == 0 {
+		t.Fatal("No log lines were dropped")
+	}
+	if len(received)-1+sink.Dropped() != logged {
+		t.Errorf("Expected %d log lines to be received or dropped, got %d received and %d dropped", logged, len(received)-1, sink.Dropped())
+	}
+	last := received[len(received)-1]
+	if last.Stream != LOG_STREAM_STDERR || last.Message != fmt.Sprintf("%d log lines were dropped, as they were not consumed in time", sink.Dropped()) {
+		t.Errorf("The dropped log lines were not reported: %#v", last)
+	}
+}
+
+func TestOrchestrateLogsOperationStopEndsRunningLogs(t *testing.T) {
+	olo := &OrchestrateLogsOperation{}
+
+	running := olo.execContext()
+	olo.Stop()
+	select {
+	case <-running.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not cancel the running logs")
+	}
+
+	// logs started after a stop run until they are stopped again
+	if next := olo.execContext(); next.Err() != nil {
+		t.Errorf("Logs started after a stop were already cancelled: %s", next.Err())
+	}
+}
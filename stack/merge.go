@@ -0,0 +1,312 @@
+package stack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	docker_cli_compose_types "github.com/docker/docker/cli/compose/types"
+)
+
+/**
+ * Merging of multiple compose files, using compose override semantics:
+ *   - scalar values are replaced by the overriding file
+ *   - multi-value service options such as dns, expose and depends_on are
+ *     appended to, leaving out values that are already there
+ *   - volumes, devices and ports are merged by the container path and port
+ *     that they target, so overriding a mount or a published port replaces
+ *     it, and secrets are merged by their source
+ *   - mappings such as environment, labels and networks are merged by key,
+ *     where a list of networks is read as a mapping without settings
+ */
+
+var (
+	// service options whose values are appended, instead of replaced
+	mergeAppendKeys = map[string]bool{
+		"depends_on":     true,
+		"dns":            true,
+		"dns_search":     true,
+		"expose":         true,
+		"external_links": true,
+		"tmpfs":          true,
+	}
+	// service options whose items are merged by the key that each item targets
+	mergeTargetKeys = map[string]func(item interface{}) (string, bool){
+		"devices": deviceTarget,
+		"ports":   portTarget,
+		"secrets": secretSource,
+		"volumes": volumeTarget,
+	}
+	// options which are mappings, but which may be written as a list of separated key value strings
+	mergeMappingKeys = map[string]string{
+		"environment": "=",
+		"labels":      "=",
+		"extra_hosts": ":",
+		"networks":    "=",
+	}
+)
+
+// mergeConfigFiles merges an ordered list of compose files into a single file, where later files override earlier ones
+func mergeConfigFiles(configFiles []docker_cli_compose_types.ConfigFile) (*docker_cli_compose_types.ConfigFile, error) {
+	if len(configFiles) == 0 {
+		return nil, fmt.Errorf("No compose files were provided to merge")
+	}
+
+	filenames := []string{}
+	merged := map[string]interface{}{}
+	for _, configFile := range configFiles {
+		filenames = append(filenames, configFile.Filename)
+
+		var err error
+		if merged, err = mergeConfigDicts(merged, configFile.Config); err != nil {
+			return nil, fmt.Errorf("Could not merge compose file %s: %s", configFile.Filename, err)
+		}
+	}
+
+	return &docker_cli_compose_types.ConfigFile{
+		Filename: strings.Join(filenames, ","),
+		Config:   merged,
+	}, nil
+}
+
+// mergeConfigDicts merges two top level compose dicts
+func mergeConfigDicts(base, override map[string]interface{}) (map[string]interface{}, error) {
+	merged := copyDict(base)
+
+	for key, value := range override {
+		current, exists := merged[key]
+		if !exists {
+			merged[key] = value
+			continue
+		}
+
+		if key != "services" {
+			merged[key] = mergeValues(key, current, value)
+			continue
+		}
+
+		currentServices, currentOk := current.(map[string]interface{})
+		services, ok := value.(map[string]interface{})
+		if !(currentOk && ok) {
+			return merged, fmt.Errorf("services must be a mapping")
+		}
+
+		mergedServices := copyDict(currentServices)
+		for name, service := range services {
+			currentService, exists := mergedServices[name]
+			if !exists {
+				mergedServices[name] = service
+				continue
+			}
+
+			currentServiceDict, currentOk := currentService.(map[string]interface{})
+			serviceDict, ok := service.(map[string]interface{})
+			if !(currentOk && ok) {
+				return merged, fmt.Errorf("service %s must be a mapping", name)
+			}
+			mergedServices[name] = mergeServiceDicts(currentServiceDict, serviceDict)
+		}
+		merged[key] = mergedServices
+	}
+
+	return merged, nil
+}
+
+// mergeServiceDicts merges two service definitions
+func mergeServiceDicts(base, override map[string]interface{}) map[string]interface{} {
+	merged := copyDict(base)
+
+	for key, value := range override {
+		current, exists := merged[key]
+		if !exists {
+			merged[key] = value
+			continue
+		}
+
+		if target, found := mergeTargetKeys[key]; found {
+			merged[key] = mergeTargetLists(toList(current), toList(value), target)
+		} else if mergeAppendKeys[key] {
+			merged[key] = appendLists(toList(current), toList(value))
+		} else {
+			merged[key] = mergeValues(key, current, value)
+		}
+	}
+
+	return merged
+}
+
+// mergeValues merges any non-service value, recursing through mappings and replacing everything else
+func mergeValues(key string, current, value interface{}) interface{} {
+	if sep, isMapping := mergeMappingKeys[key]; isMapping {
+		currentDict, currentOk := toDict(current, sep)
+		dict, ok := toDict(value, sep)
+		if currentOk && ok {
+			return mergeDicts(currentDict, dict)
+		}
+		return value
+	}
+
+	currentDict, currentOk := current.(map[string]interface{})
+	dict, ok := value.(map[string]interface{})
+	if currentOk && ok {
+		return mergeDicts(currentDict, dict)
+	}
+	return value
+}
+
+func mergeDicts(base, override map[string]interface{}) map[string]interface{} {
+	merged := copyDict(base)
+	for key, value := range override {
+		if current, exists := merged[key]; exists {
+			merged[key] = mergeValues(key, current, value)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// appendLists appends all values that are not already in the base list
+func appendLists(base, override []interface{}) []interface{} {
+	merged := append([]interface{}{}, base...)
+	for _, value := range override {
+		exists := false
+		for _, current := range merged {
+			if reflect.DeepEqual(current, value) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// mergeTargetLists replaces the base items that target the same key as an overriding item, and appends the rest
+func mergeTargetLists(base, override []interface{}, target func(item interface{}) (string, bool)) []interface{} {
+	overridden := map[string]bool{}
+	for _, value := range override {
+		if key, ok := target(value); ok {
+			overridden[key] = true
+		}
+	}
+
+	kept := []interface{}{}
+	for _, current := range base {
+		if key, ok := target(current); ok && overridden[key] {
+			continue
+		}
+		kept = append(kept, current)
+	}
+	return appendLists(kept, override)
+}
+
+// volumeTarget provides the container path of a "[source:]target[:mode]" or long syntax volume
+func volumeTarget(item interface{}) (string, bool) {
+	switch typed := item.(type) {
+	case map[string]interface{}:
+		target, ok := typed["target"].(string)
+		return target, ok
+	case string:
+		parts := strings.Split(typed, ":")
+		// a windows source such as C:\data holds a separator of its own
+		if len(parts) > 2 && len(parts[0]) == 1 {
+			parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+		}
+		if len(parts) == 1 {
+			return parts[0], true
+		}
+		return parts[1], true
+	}
+	return "", false
+}
+
+// deviceTarget provides the container path of a "host[:container[:permissions]]" device
+func deviceTarget(item interface{}) (string, bool) {
+	device, ok := item.(string)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(device, ":")
+	if len(parts) == 1 {
+		return parts[0], true
+	}
+	return parts[1], true
+}
+
+// secretSource provides the secret that a short or long syntax secret reference uses
+func secretSource(item interface{}) (string, bool) {
+	switch typed := item.(type) {
+	case map[string]interface{}:
+		source, ok := typed["source"].(string)
+		return source, ok
+	case string:
+		return typed, true
+	}
+	return "", false
+}
+
+// portTarget provides the container port and protocol of a "[[ip:]published:]target[/protocol]" or long syntax port
+func portTarget(item interface{}) (string, bool) {
+	switch typed := item.(type) {
+	case map[string]interface{}:
+		protocol, _ := typed["protocol"].(string)
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		if target, ok := typed["target"]; ok {
+			return fmt.Sprintf("%v/%s", target, protocol), true
+		}
+	case int:
+		return fmt.Sprintf("%d/tcp", typed), true
+	case string:
+		protocol := "tcp"
+		if slash := strings.LastIndex(typed, "/"); slash >= 0 {
+			protocol = typed[slash+1:]
+			typed = typed[:slash]
+		}
+		return typed[strings.LastIndex(typed, ":")+1:] + "/" + protocol, true
+	}
+	return "", false
+}
+
+// toList converts single values to a list, as compose allows for some list options
+func toList(value interface{}) []interface{} {
+	if list, ok := value.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{value}
+}
+
+// toDict converts a list of "key{sep}value" strings to a mapping, as compose allows for mapping options
+func toDict(value interface{}, sep string) (map[string]interface{}, bool) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case []interface{}:
+		dict := map[string]interface{}{}
+		for _, item := range typed {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			if parts := strings.SplitN(str, sep, 2); len(parts) == 2 {
+				dict[parts[0]] = parts[1]
+			} else {
+				dict[parts[0]] = nil
+			}
+		}
+		return dict, true
+	}
+	return nil, false
+}
+
+func copyDict(dict map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(dict))
+	for key, value := range dict {
+		copied[key] = value
+	}
+	return copied
+}
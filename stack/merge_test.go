@@ -0,0 +1,155 @@
+package stack
+
+import (
+	"reflect"
+	"testing"
+
+	docker_cli_compose_types "github.com/docker/docker/cli/compose/types"
+)
+
+func TestMergeServiceDicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     map[string]interface{}
+		override map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "scalars are replaced",
+			base:     map[string]interface{}{"image": "nginx:1.11", "user": "www"},
+			override: map[string]interface{}{"image": "nginx:1.13"},
+			expected: map[string]interface{}{"image": "nginx:1.13", "user": "www"},
+		},
+		{
+			name:     "lists are appended without duplicates",
+			base:     map[string]interface{}{"dns": []interface{}{"8.8.8.8"}, "expose": []interface{}{"80"}},
+			override: map[string]interface{}{"dns": "8.8.4.4", "expose": []interface{}{"80", "443"}},
+			expected: map[string]interface{}{"dns": []interface{}{"8.8.8.8", "8.8.4.4"}, "expose": []interface{}{"80", "443"}},
+		},
+		{
+			name:     "mappings are merged by key",
+			base:     map[string]interface{}{"environment": []interface{}{"DEBUG=0", "LANG=C"}, "labels": map[string]interface{}{"tier": "web"}},
+			override: map[string]interface{}{"environment": map[string]interface{}{"DEBUG": "1"}, "labels": []interface{}{"team=shop"}},
+			expected: map[string]interface{}{
+				"environment": map[string]interface{}{"DEBUG": "1", "LANG": "C"},
+				"labels":      map[string]interface{}{"tier": "web", "team": "shop"},
+			},
+		},
+		{
+			name: "volumes are merged by container path",
+			base: map[string]interface{}{"volumes": []interface{}{
+				"./src:/app",
+				"data:/var/lib/data:ro",
+				map[string]interface{}{"type": "volume", "source": "cache", "target": "/cache"},
+			}},
+			override: map[string]interface{}{"volumes": []interface{}{
+				"data:/var/lib/data",
+				map[string]interface{}{"type": "tmpfs", "target": "/cache"},
+				"/tmp",
+			}},
+			expected: map[string]interface{}{"volumes": []interface{}{
+				"./src:/app",
+				"data:/var/lib/data",
+				map[string]interface{}{"type": "tmpfs", "target": "/cache"},
+				"/tmp",
+			}},
+		},
+		{
+			name:     "ports are merged by target and protocol",
+			base:     map[string]interface{}{"ports": []interface{}{"8080:80", "53:53/udp", 443}},
+			override: map[string]interface{}{"ports": []interface{}{"9090:80", "53:53", map[string]interface{}{"target": 443, "published": 8443}}},
+			expected: map[string]interface{}{"ports": []interface{}{
+				"53:53/udp",
+				"9090:80",
+				"53:53",
+				map[string]interface{}{"target": 443, "published": 8443},
+			}},
+		},
+		{
+			name: "secrets are merged by source",
+			base: map[string]interface{}{"secrets": []interface{}{
+				"token",
+				map[string]interface{}{"source": "key", "target": "app.key"},
+			}},
+			override: map[string]interface{}{"secrets": []interface{}{
+				map[string]interface{}{"source": "key", "target": "server.key"},
+				"cert",
+			}},
+			expected: map[string]interface{}{"secrets": []interface{}{
+				"token",
+				map[string]interface{}{"source": "key", "target": "server.key"},
+				"cert",
+			}},
+		},
+		{
+			name:     "dependencies are merged as a set",
+			base:     map[string]interface{}{"depends_on": []interface{}{"db", "cache"}},
+			override: map[string]interface{}{"depends_on": []interface{}{"cache", "queue"}},
+			expected: map[string]interface{}{"depends_on": []interface{}{"db", "cache", "queue"}},
+		},
+		{
+			name: "networks are merged as a mapping",
+			base: map[string]interface{}{"networks": []interface{}{"front", "back"}},
+			override: map[string]interface{}{"networks": map[string]interface{}{
+				"back":  map[string]interface{}{"aliases": []interface{}{"api"}},
+				"admin": nil,
+			}},
+			expected: map[string]interface{}{"networks": map[string]interface{}{
+				"front": nil,
+				"back":  map[string]interface{}{"aliases": []interface{}{"api"}},
+				"admin": nil,
+			}},
+		},
+		{
+			name:     "devices are merged by container path",
+			base:     map[string]interface{}{"devices": []interface{}{"/dev/ttyUSB0:/dev/ttyUSB0", "/dev/sda:/dev/xvda:rwm"}},
+			override: map[string]interface{}{"devices": []interface{}{"/dev/ttyUSB1:/dev/ttyUSB0", "/dev/snd"}},
+			expected: map[string]interface{}{"devices": []interface{}{"/dev/sda:/dev/xvda:rwm", "/dev/ttyUSB1:/dev/ttyUSB0", "/dev/snd"}},
+		},
+	}
+
+	for _, test := range tests {
+		if merged := mergeServiceDicts(test.base, test.override); !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.name, test.expected, merged)
+		}
+	}
+}
+
+func TestMergeConfigFiles(t *testing.T) {
+	merged, err := mergeConfigFiles([]docker_cli_compose_types.ConfigFile{
+		{Filename: "docker-compose.yml", Config: map[string]interface{}{
+			"version":  "3",
+			"services": map[string]interface{}{"web": map[string]interface{}{"image": "nginx"}},
+			"networks": map[string]interface{}{"front": map[string]interface{}{"driver": "overlay"}},
+		}},
+		{Filename: "docker-compose.prod.yml", Config: map[string]interface{}{
+			"services": map[string]interface{}{
+				"web":    map[string]interface{}{"ports": []interface{}{"80:80"}},
+				"worker": map[string]interface{}{"image": "worker"},
+			},
+			"networks": map[string]interface{}{"front": map[string]interface{}{"attachable": true}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected merge error: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"version": "3",
+		"services": map[string]interface{}{
+			"web":    map[string]interface{}{"image": "nginx", "ports": []interface{}{"80:80"}},
+			"worker": map[string]interface{}{"image": "worker"},
+		},
+		"networks": map[string]interface{}{"front": map[string]interface{}{"driver": "overlay", "attachable": true}},
+	}
+	if merged.Filename != "docker-compose.yml,docker-compose.prod.yml" || !reflect.DeepEqual(merged.Config, expected) {
+		t.Errorf("Expected %#v, got %s %#v", expected, merged.Filename, merged.Config)
+	}
+
+	if _, err := mergeConfigFiles([]docker_cli_compose_types.ConfigFile{
+		{Config: map[string]interface{}{"services": map[string]interface{}{}}},
+		{Config: map[string]interface{}{"services": []interface{}{"web"}}},
+	}); err == nil {
+		t.Error("Services that are not a mapping were merged")
+	}
+}
@@ -1,6 +1,9 @@
 package stack
 
 import (
+	"context"
+	"os"
+
 	api "github.com/CoachApplication/api"
 	base "github.com/CoachApplication/base"
 	handler_dockercli "github.com/CoachApplication/handler-dockercli"
@@ -12,14 +15,33 @@ const (
 
 type OrchestrateDownOperation struct {
 	handler_dockercli.ClientOperationBase
+
+	opts   removeOptions
+	events EventSink
 }
 
 func NewOrchestrateDownOperation(base handler_dockercli.ClientOperationBase) *OrchestrateDownOperation {
 	return &OrchestrateDownOperation{
 		ClientOperationBase: base,
+		opts:                newRemoveOptionsDefault(),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestrateDownOperationForProject removes the stack of the project in projectRoot
+func NewOrchestrateDownOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestrateDownOperation {
+	return &OrchestrateDownOperation{
+		ClientOperationBase: base,
+		opts:                newRemoveOptionsForProject(projectRoot),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
 	}
 }
 
+// SetEventSink replaces where stack progress is reported, in addition to the events stream on the operation result
+func (odo *OrchestrateDownOperation) SetEventSink(events EventSink) {
+	odo.events = events
+}
+
 func (odo *OrchestrateDownOperation) Operation() api.Operation {
 	return api.Operation(odo)
 }
@@ -31,8 +53,8 @@ func (odo *OrchestrateDownOperation) Id() string {
 func (odo *OrchestrateDownOperation) Ui() api.Ui {
 	return base.NewUi(
 		odo.Id(),
-		"Orchestrate up",
-		"Bring up the application app stack",
+		"Orchestrate down",
+		"Remove the application app stack",
 		"",
 	)
 }
@@ -42,15 +64,47 @@ func (odo *OrchestrateDownOperation) Usage() api.Usage {
 }
 
 func (odo *OrchestrateDownOperation) Properties() api.Properties {
-	props := base.NewProperties()
-
-	return props.Properties()
+	return odo.opts.Properties()
 }
 
 func (odo *OrchestrateDownOperation) Validate(props api.Properties) api.Result {
-	return base.MakeSuccessfulResult()
+	return resultFromErrors(odo.opts.withProperties(props).validate())
 }
 
 func (odo *OrchestrateDownOperation) Exec(props api.Properties) api.Result {
-	return base.MakeSuccessfulResult()
+	res := base.NewResult()
+	resultEvents := NewResultEventSink(res)
+	events := MultiEventSink{odo.events, resultEvents}
+
+	go func(opts removeOptions) {
+		defer res.MarkFinished()
+		defer resultEvents.Close()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := odo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		if errs := runRemove(context.Background(), client, events, opts); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		res.MarkSucceeded()
+	}(odo.opts.withProperties(props))
+
+	return res.Result()
 }
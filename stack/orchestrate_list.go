@@ -0,0 +1,81 @@
+package stack
+
+import (
+	"context"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_ORCHESTRATE_LIST = "orchestrate.list"
+)
+
+type OrchestrateListOperation struct {
+	handler_dockercli.ClientOperationBase
+}
+
+func NewOrchestrateListOperation(base handler_dockercli.ClientOperationBase) *OrchestrateListOperation {
+	return &OrchestrateListOperation{
+		ClientOperationBase: base,
+	}
+}
+
+func (olo *OrchestrateListOperation) Operation() api.Operation {
+	return api.Operation(olo)
+}
+
+func (olo *OrchestrateListOperation) Id() string {
+	return OPERATION_ID_ORCHESTRATE_LIST
+}
+
+func (olo *OrchestrateListOperation) Ui() api.Ui {
+	return base.NewUi(
+		olo.Id(),
+		"Orchestrate list",
+		"List every stack deployed on the swarm",
+		"",
+	)
+}
+
+func (olo *OrchestrateListOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (olo *OrchestrateListOperation) Properties() api.Properties {
+	return base.NewProperties().Properties()
+}
+
+func (olo *OrchestrateListOperation) Validate(props api.Properties) api.Result {
+	return resultFromErrors([]error{})
+}
+
+func (olo *OrchestrateListOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+
+	go func() {
+		defer res.MarkFinished()
+
+		client, err := olo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		stacks, err := runList(context.Background(), client)
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		stacksProp := &StacksProperty{}
+		stacksProp.Set(stacks)
+		res.AddProperty(stacksProp.Property())
+		res.MarkSucceeded()
+	}()
+
+	return res.Result()
+}
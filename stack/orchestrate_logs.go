@@ -0,0 +1,137 @@
+package stack
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_ORCHESTRATE_LOGS = "orchestrate.logs"
+)
+
+type OrchestrateLogsOperation struct {
+	handler_dockercli.ClientOperationBase
+
+	opts logsOptions
+	logs LogSink
+
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewOrchestrateLogsOperation(base handler_dockercli.ClientOperationBase) *OrchestrateLogsOperation {
+	return &OrchestrateLogsOperation{
+		ClientOperationBase: base,
+		opts:                newLogsOptionsDefault(),
+		logs:                NewWriterLogSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestrateLogsOperationForProject streams the logs of the stack of the project in projectRoot
+func NewOrchestrateLogsOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestrateLogsOperation {
+	return &OrchestrateLogsOperation{
+		ClientOperationBase: base,
+		opts:                newLogsOptionsForProject(projectRoot),
+		logs:                NewWriterLogSink(os.Stdout, os.Stderr),
+	}
+}
+
+// SetLogSink replaces where log lines are written, in addition to the logs stream on the operation result
+func (olo *OrchestrateLogsOperation) SetLogSink(logs LogSink) {
+	olo.logs = logs
+}
+
+// Stop ends the logs of every Exec that is still running, which is how logs that follow the services are ended
+func (olo *OrchestrateLogsOperation) Stop() {
+	olo.lock.Lock()
+	defer olo.lock.Unlock()
+
+	if olo.cancel != nil {
+		olo.cancel()
+		olo.ctx, olo.cancel = nil, nil
+	}
+}
+
+// execContext provides the context that the logs run in, which is cancelled by Stop
+func (olo *OrchestrateLogsOperation) execContext() context.Context {
+	olo.lock.Lock()
+	defer olo.lock.Unlock()
+
+	if olo.ctx == nil {
+		olo.ctx, olo.cancel = context.WithCancel(context.Background())
+	}
+	return olo.ctx
+}
+
+func (olo *OrchestrateLogsOperation) Operation() api.Operation {
+	return api.Operation(olo)
+}
+
+func (olo *OrchestrateLogsOperation) Id() string {
+	return OPERATION_ID_ORCHESTRATE_LOGS
+}
+
+func (olo *OrchestrateLogsOperation) Ui() api.Ui {
+	return base.NewUi(
+		olo.Id(),
+		"Orchestrate logs",
+		"Stream the logs of the application stack services",
+		"",
+	)
+}
+
+func (olo *OrchestrateLogsOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (olo *OrchestrateLogsOperation) Properties() api.Properties {
+	return olo.opts.Properties()
+}
+
+func (olo *OrchestrateLogsOperation) Validate(props api.Properties) api.Result {
+	return resultFromErrors(olo.opts.withProperties(props).validate())
+}
+
+func (olo *OrchestrateLogsOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+	resultLogs := NewResultLogSink(res)
+	logs := MultiLogSink{olo.logs, resultLogs}
+
+	ctx := olo.execContext()
+
+	go func(opts logsOptions) {
+		defer res.MarkFinished()
+		defer resultLogs.Close()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := olo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		if err := runLogs(ctx, client, logs, opts); err != nil {
+			addResultErrors(res, err)
+			res.MarkFailed()
+			return
+		}
+
+		res.MarkSucceeded()
+	}(olo.opts.withProperties(props))
+
+	return res.Result()
+}
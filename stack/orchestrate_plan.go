@@ -0,0 +1,125 @@
+package stack
+
+import (
+	"context"
+	"os"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	coach_config "github.com/CoachApplication/config"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_ORCHESTRATE_PLAN = "orchestrate.plan"
+)
+
+type OrchestratePlanOperation struct {
+	handler_dockercli.ClientOperationBase
+
+	opts   deployOptions
+	events EventSink
+}
+
+func NewOrchestratePlanOperation(base handler_dockercli.ClientOperationBase) *OrchestratePlanOperation {
+	return &OrchestratePlanOperation{
+		ClientOperationBase: base,
+		opts:                newDeployOptionsDefault(),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestratePlanOperationForProject plans the deploy of the compose files of the project in projectRoot
+func NewOrchestratePlanOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestratePlanOperation {
+	return &OrchestratePlanOperation{
+		ClientOperationBase: base,
+		opts:                newDeployOptionsForProject(projectRoot),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestratePlanOperationFromConfig plans the deploy of the compose definition held in a Coach config, for the project in projectRoot
+func NewOrchestratePlanOperationFromConfig(base handler_dockercli.ClientOperationBase, config coach_config.Config, projectRoot string) *OrchestratePlanOperation {
+	opts := newDeployOptionsForProject(projectRoot)
+	opts.composeConfig = config
+
+	return &OrchestratePlanOperation{
+		ClientOperationBase: base,
+		opts:                opts,
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// SetEventSink replaces where the planned changes are reported, in addition to the plan on the operation result
+func (opo *OrchestratePlanOperation) SetEventSink(events EventSink) {
+	opo.events = events
+}
+
+func (opo *OrchestratePlanOperation) Operation() api.Operation {
+	return api.Operation(opo)
+}
+
+func (opo *OrchestratePlanOperation) Id() string {
+	return OPERATION_ID_ORCHESTRATE_PLAN
+}
+
+func (opo *OrchestratePlanOperation) Ui() api.Ui {
+	return base.NewUi(
+		opo.Id(),
+		"Orchestrate plan",
+		"List the changes that bringing up the application stack would make",
+		"",
+	)
+}
+
+func (opo *OrchestratePlanOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (opo *OrchestratePlanOperation) Properties() api.Properties {
+	return opo.opts.Properties()
+}
+
+func (opo *OrchestratePlanOperation) Validate(props api.Properties) api.Result {
+	return resultFromErrors(opo.opts.withProperties(props).validate())
+}
+
+func (opo *OrchestratePlanOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+	resultEvents := NewResultEventSink(res)
+	events := MultiEventSink{opo.events, resultEvents}
+
+	go func(opts deployOptions) {
+		defer res.MarkFinished()
+		defer resultEvents.Close()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := opo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		plan, err := runPlan(context.Background(), client, events, opts)
+		if err != nil {
+			addResultErrors(res, err)
+			res.MarkFailed()
+			return
+		}
+
+		planProp := &PlanProperty{}
+		planProp.Set(plan)
+		res.AddProperty(planProp.Property())
+		res.MarkSucceeded()
+	}(opo.opts.withProperties(props))
+
+	return res.Result()
+}
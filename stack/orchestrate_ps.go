@@ -0,0 +1,100 @@
+package stack
+
+import (
+	"context"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_ORCHESTRATE_PS = "orchestrate.ps"
+)
+
+type OrchestratePsOperation struct {
+	handler_dockercli.ClientOperationBase
+
+	opts statusOptions
+}
+
+func NewOrchestratePsOperation(base handler_dockercli.ClientOperationBase) *OrchestratePsOperation {
+	return &OrchestratePsOperation{
+		ClientOperationBase: base,
+		opts:                newStatusOptionsDefault(),
+	}
+}
+
+// NewOrchestratePsOperationForProject lists the services and tasks of the stack of the project in projectRoot
+func NewOrchestratePsOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestratePsOperation {
+	return &OrchestratePsOperation{
+		ClientOperationBase: base,
+		opts:                newStatusOptionsForProject(projectRoot),
+	}
+}
+
+func (opo *OrchestratePsOperation) Operation() api.Operation {
+	return api.Operation(opo)
+}
+
+func (opo *OrchestratePsOperation) Id() string {
+	return OPERATION_ID_ORCHESTRATE_PS
+}
+
+func (opo *OrchestratePsOperation) Ui() api.Ui {
+	return base.NewUi(
+		opo.Id(),
+		"Orchestrate ps",
+		"List the services and tasks of the application stack",
+		"",
+	)
+}
+
+func (opo *OrchestratePsOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (opo *OrchestratePsOperation) Properties() api.Properties {
+	return opo.opts.Properties()
+}
+
+func (opo *OrchestratePsOperation) Validate(props api.Properties) api.Result {
+	return resultFromErrors(opo.opts.withProperties(props).validate())
+}
+
+func (opo *OrchestratePsOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+
+	go func(opts statusOptions) {
+		defer res.MarkFinished()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := opo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		status, err := runStatus(context.Background(), client, opts)
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		statusProp := &StatusProperty{}
+		statusProp.Set(status)
+		res.AddProperty(statusProp.Property())
+		res.MarkSucceeded()
+	}(opo.opts.withProperties(props))
+
+	return res.Result()
+}
@@ -0,0 +1,108 @@
+package stack
+
+import (
+	"context"
+	"os"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	handler_dockercli "github.com/CoachApplication/handler-dockercli"
+)
+
+const (
+	OPERATION_ID_ORCHESTRATE_SCALE = "orchestrate.scale"
+)
+
+type OrchestrateScaleOperation struct {
+	handler_dockercli.ClientOperationBase
+
+	opts   scaleOptions
+	events EventSink
+}
+
+func NewOrchestrateScaleOperation(base handler_dockercli.ClientOperationBase) *OrchestrateScaleOperation {
+	return &OrchestrateScaleOperation{
+		ClientOperationBase: base,
+		opts:                newScaleOptionsDefault(),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestrateScaleOperationForProject scales services of the stack of the project in projectRoot
+func NewOrchestrateScaleOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestrateScaleOperation {
+	return &OrchestrateScaleOperation{
+		ClientOperationBase: base,
+		opts:                newScaleOptionsForProject(projectRoot),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// SetEventSink replaces where stack progress is reported, in addition to the events stream on the operation result
+func (oso *OrchestrateScaleOperation) SetEventSink(events EventSink) {
+	oso.events = events
+}
+
+func (oso *OrchestrateScaleOperation) Operation() api.Operation {
+	return api.Operation(oso)
+}
+
+func (oso *OrchestrateScaleOperation) Id() string {
+	return OPERATION_ID_ORCHESTRATE_SCALE
+}
+
+func (oso *OrchestrateScaleOperation) Ui() api.Ui {
+	return base.NewUi(
+		oso.Id(),
+		"Orchestrate scale",
+		"Set the number of replicas of application stack services",
+		"",
+	)
+}
+
+func (oso *OrchestrateScaleOperation) Usage() api.Usage {
+	return (&base.ExternalOperationUsage{}).Usage()
+}
+
+func (oso *OrchestrateScaleOperation) Properties() api.Properties {
+	return oso.opts.Properties()
+}
+
+func (oso *OrchestrateScaleOperation) Validate(props api.Properties) api.Result {
+	return resultFromErrors(oso.opts.withProperties(props).validate())
+}
+
+func (oso *OrchestrateScaleOperation) Exec(props api.Properties) api.Result {
+	res := base.NewResult()
+	resultEvents := NewResultEventSink(res)
+	events := MultiEventSink{oso.events, resultEvents}
+
+	go func(opts scaleOptions) {
+		defer res.MarkFinished()
+		defer resultEvents.Close()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := oso.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		if err := runScale(context.Background(), client, events, opts); err != nil {
+			addResultErrors(res, err)
+			res.MarkFailed()
+			return
+		}
+
+		res.MarkSucceeded()
+	}(oso.opts.withProperties(props))
+
+	return res.Result()
+}
@@ -1,8 +1,12 @@
 package stack
 
 import (
+	"context"
+	"os"
+
 	api "github.com/CoachApplication/api"
 	base "github.com/CoachApplication/base"
+	coach_config "github.com/CoachApplication/config"
 	handler_dockercli "github.com/CoachApplication/handler-dockercli"
 )
 
@@ -10,24 +14,47 @@ const (
 	OPERATION_ID_ORCHESTRATE_UP = "orchestrate.up"
 )
 
-type deployOptions struct {
-	bundlefile       string
-	composefile      string
-	namespace        string
-	sendRegistryAuth bool
-	prune            bool
-}
-
 type OrchestrateUpOperation struct {
 	handler_dockercli.ClientOperationBase
+
+	opts   deployOptions
+	events EventSink
 }
 
 func NewOrchestrateUpOperation(base handler_dockercli.ClientOperationBase) *OrchestrateUpOperation {
 	return &OrchestrateUpOperation{
 		ClientOperationBase: base,
+		opts:                newDeployOptionsDefault(),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// NewOrchestrateUpOperationForProject deploys the compose files of the project in projectRoot
+func NewOrchestrateUpOperationForProject(base handler_dockercli.ClientOperationBase, projectRoot string) *OrchestrateUpOperation {
+	return &OrchestrateUpOperation{
+		ClientOperationBase: base,
+		opts:                newDeployOptionsForProject(projectRoot),
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
 	}
 }
 
+// NewOrchestrateUpOperationFromConfig deploys the compose definition held in a Coach config, for the project in projectRoot
+func NewOrchestrateUpOperationFromConfig(base handler_dockercli.ClientOperationBase, config coach_config.Config, projectRoot string) *OrchestrateUpOperation {
+	opts := newDeployOptionsForProject(projectRoot)
+	opts.composeConfig = config
+
+	return &OrchestrateUpOperation{
+		ClientOperationBase: base,
+		opts:                opts,
+		events:              NewWriterEventSink(os.Stdout, os.Stderr),
+	}
+}
+
+// SetEventSink replaces where stack progress is reported, in addition to the events stream on the operation result
+func (ouo *OrchestrateUpOperation) SetEventSink(events EventSink) {
+	ouo.events = events
+}
+
 func (ouo *OrchestrateUpOperation) Operation() api.Operation {
 	return api.Operation(ouo)
 }
@@ -50,15 +77,78 @@ func (ouo *OrchestrateUpOperation) Usage() api.Usage {
 }
 
 func (ouo *OrchestrateUpOperation) Properties() api.Properties {
-	props := base.NewProperties()
-
-	return props.Properties()
+	return ouo.opts.Properties()
 }
 
 func (ouo *OrchestrateUpOperation) Validate(props api.Properties) api.Result {
-	return base.MakeSuccessfulResult()
+	return resultFromErrors(ouo.opts.withProperties(props).validate())
 }
 
 func (ouo *OrchestrateUpOperation) Exec(props api.Properties) api.Result {
-	return base.MakeSuccessfulResult()
+	res := base.NewResult()
+	resultEvents := NewResultEventSink(res)
+	events := MultiEventSink{ouo.events, resultEvents}
+
+	go func(opts deployOptions) {
+		defer res.MarkFinished()
+		defer resultEvents.Close()
+
+		if errs := opts.validate(); len(errs) > 0 {
+			for _, err := range errs {
+				res.AddError(err)
+			}
+			res.MarkFailed()
+			return
+		}
+
+		client, err := ouo.DockerClientOrError()
+		if err != nil {
+			res.AddError(err)
+			res.MarkFailed()
+			return
+		}
+
+		if opts.dryRun {
+			plan, err := runPlan(context.Background(), client, events, opts)
+			if err != nil {
+				addResultErrors(res, err)
+				res.MarkFailed()
+				return
+			}
+
+			planProp := &PlanProperty{}
+			planProp.Set(plan)
+			res.AddProperty(planProp.Property())
+			res.MarkSucceeded()
+			return
+		}
+
+		registryAuth := noRegistryAuth
+		if opts.sendRegistryAuth {
+			// registry credentials are read from the docker CLI configuration
+			dockerCli, err := handler_dockercli.DefaultDockerCli(os.Stdout, os.Stderr)
+			if err != nil {
+				res.AddError(err)
+				res.MarkFailed()
+				return
+			}
+			registryAuth = dockerCliRegistryAuth(dockerCli)
+		}
+
+		report, err := runDeploy(context.Background(), client, events, registryAuth, opts)
+		if report != nil {
+			reportProp := &RollbackReportProperty{}
+			reportProp.Set(report)
+			res.AddProperty(reportProp.Property())
+		}
+		if err != nil {
+			addResultErrors(res, err)
+			res.MarkFailed()
+			return
+		}
+
+		res.MarkSucceeded()
+	}(ouo.opts.withProperties(props))
+
+	return res.Result()
 }
@@ -0,0 +1,113 @@
+package stack
+
+import (
+	"sync"
+)
+
+/**
+ * Stack resources are created, updated and removed by a bounded pool of
+ * workers. Each resource reports its progress to its own event sink, and
+ * those events are passed on in resource order, so that the output is the
+ * same no matter which worker finishes first.
+ */
+
+const (
+	defaultParallelism = 4
+)
+
+// runParallel runs a task for each of count resources, with at most limit running at once, and returns their errors in resource order
+func runParallel(count, limit int, events EventSink, task func(i int, events EventSink) error) []error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	ordered := newOrderedEventSink(events, count)
+	results := make([]error, count)
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			results[i] = task(i, ordered.item(i))
+			ordered.finish(i)
+		}(i)
+	}
+	wg.Wait()
+
+	errs := []error{}
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// orderedEventSink passes on the events of a number of resources in resource order.
+//
+// Events of the first unfinished resource are passed on as they arrive;
+// events of later resources are held back until every earlier resource
+// has finished.
+type orderedEventSink struct {
+	events EventSink
+
+	lock    sync.Mutex
+	buffers [][]Event
+	done    []bool
+	next    int
+}
+
+func newOrderedEventSink(events EventSink, count int) *orderedEventSink {
+	return &orderedEventSink{
+		events:  events,
+		buffers: make([][]Event, count),
+		done:    make([]bool, count),
+	}
+}
+
+// item provides the event sink for a single resource
+func (oes *orderedEventSink) item(i int) EventSink {
+	return orderedItemEventSink{ordered: oes, index: i}
+}
+
+func (oes *orderedEventSink) emit(i int, event Event) {
+	oes.lock.Lock()
+	defer oes.lock.Unlock()
+
+	if i == oes.next {
+		oes.events.Emit(event)
+	} else {
+		oes.buffers[i] = append(oes.buffers[i], event)
+	}
+}
+
+// finish marks a resource as done, and passes on the held back events of any resources that are now next
+func (oes *orderedEventSink) finish(i int) {
+	oes.lock.Lock()
+	defer oes.lock.Unlock()
+
+	oes.done[i] = true
+	for oes.next < len(oes.done) && oes.done[oes.next] {
+		oes.next++
+		if oes.next < len(oes.buffers) {
+			for _, event := range oes.buffers[oes.next] {
+				oes.events.Emit(event)
+			}
+			oes.buffers[oes.next] = nil
+		}
+	}
+}
+
+type orderedItemEventSink struct {
+	ordered *orderedEventSink
+	index   int
+}
+
+func (oies orderedItemEventSink) Emit(event Event) {
+	oies.ordered.emit(oies.index, event)
+}
@@ -0,0 +1,64 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunParallelLimitsConcurrency(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+
+	runParallel(10, 3, &recordingEventSink{}, func(i int, events EventSink) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return nil
+	})
+
+	if maxRunning > 3 {
+		t.Errorf("Expected at most 3 tasks to run at once, but %d did", maxRunning)
+	}
+}
+
+func TestRunParallelKeepsResourceOrder(t *testing.T) {
+	events := &recordingEventSink{}
+
+	errs := runParallel(5, 5, events, func(i int, events EventSink) error {
+		name := fmt.Sprintf("service%d", i)
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Status: EVENT_STATUS_STARTED})
+		// later resources finish first
+		time.Sleep(time.Duration(5-i) * 5 * time.Millisecond)
+		if i%2 == 1 {
+			return errors.New(name)
+		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Status: EVENT_STATUS_SUCCEEDED})
+		return nil
+	})
+
+	if len(errs) != 2 || errs[0].Error() != "service1" || errs[1].Error() != "service3" {
+		t.Errorf("Expected the errors of service1 and service3 in order, got: %v", errs)
+	}
+
+	expected := []string{"service0", "service0", "service1", "service2", "service2", "service3", "service4", "service4"}
+	if len(events.events) != len(expected) {
+		t.Fatalf("Expected %d events, got: %#v", len(expected), events.events)
+	}
+	for i, event := range events.events {
+		if event.Name != expected[i] {
+			t.Errorf("Expected event %d to be for %s, got %s", i, expected[i], event.Name)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+	docker_cli_compose_types "github.com/docker/docker/cli/compose/types"
+	docker_client "github.com/docker/docker/client"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+const (
+	PROPERTY_ID_STACK_PLAN = "stack.plan"
+)
+
+/**
+ * A plan lists the changes that a deploy would make, without making any,
+ * so that they can be reviewed before the stack is deployed.
+ *
+ * Planning loads and converts the stack exactly like a deploy does, and
+ * only reads from the swarm to decide what would be created, updated or
+ * pruned, using the same selection as the deploy.
+ */
+
+// Plan is the list of changes that deploying a stack would make, in the order the deploy makes them
+type Plan struct {
+	Namespace string       `json:"namespace"`
+	Changes   []PlanChange `json:"changes"`
+}
+
+// PlanChange is a single resource that a deploy would create, update or remove
+type PlanChange struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name"`
+	Action string      `json:"action"`
+	Diff   []FieldDiff `json:"diff,omitempty"`
+}
+
+func (pc PlanChange) event() Event {
+	diffs := []string{}
+	for _, diff := range pc.Diff {
+		diffs = append(diffs, diff.String())
+	}
+	return Event{Kind: pc.Kind, Name: pc.Name, Action: pc.Action, Status: EVENT_STATUS_PLANNED, Message: strings.Join(diffs, "; ")}
+}
+
+// runPlan builds the plan for deploying the stack described in the options
+func runPlan(ctx context.Context, client StackClient, events EventSink, opts deployOptions) (*Plan, error) {
+	var plan *Plan
+	var err error
+
+	switch {
+	case opts.namespace == "":
+		return nil, errors.New("No stack namespace was provided for the plan.")
+	case opts.bundlefile != "" && len(opts.composefiles) > 0:
+		return nil, errors.New("You cannot specify both a bundle file and Compose files.")
+	case opts.bundlefile != "":
+		plan, err = planBundle(ctx, client, events, opts)
+	default:
+		config, loadErr := loadComposeSource(ctx, client, events, opts)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		plan, err = planComposeConfig(ctx, client, config, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range plan.Changes {
+		events.Emit(change.event())
+	}
+	return plan, nil
+}
+
+func planComposeConfig(ctx context.Context, client StackClient, config *docker_cli_compose_types.Config, opts deployOptions) (*Plan, error) {
+	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
+	plan := &Plan{Namespace: opts.namespace, Changes: []PlanChange{}}
+
+	if _, err := dependencyLevels(getServiceNames(config.Services), getServiceDependencies(config.Services)); err != nil {
+		return nil, err
+	}
+
+	if opts.prune {
+		services := map[string]struct{}{}
+		for _, service := range config.Services {
+			services[service.Name] = struct{}{}
+		}
+		changes, err := planPruneServices(ctx, client, namespace, services)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	serviceNetworks := getServicesDeclaredNetworks(config.Services)
+	networks, externalNetworks := docker_cli_compose_convert.Networks(namespace, config.Networks, serviceNetworks)
+	if err := validateExternalNetworks(ctx, client, externalNetworks); err != nil {
+		return nil, err
+	}
+	changes, err := planNetworks(ctx, client, namespace, networks)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	resolveSecretFiles(config, opts)
+	secrets, err := docker_cli_compose_convert.Secrets(namespace, config.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	secrets = versionSecrets(secrets)
+	changes, err = planSecrets(ctx, client, secrets)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	// the secrets don't exist yet, so the services are converted as if they had been created
+	services, err := docker_cli_compose_convert.Services(namespace, config, newPlanConvertClient(client, secrets))
+	if err != nil {
+		return nil, err
+	}
+	useSecretVersions(services, secrets)
+	changes, err = planServices(ctx, client, namespace, services)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	// removals depend on what the services would use once they are deployed
+	usedNetworks, usedSecrets, err := getPlannedUsage(ctx, client, namespace, services, opts.prune)
+	if err != nil {
+		return nil, err
+	}
+	changes, err = planUnusedSecretVersions(ctx, client, namespace, secrets, usedSecrets)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	if opts.prune {
+		changes, err = planPruneNetworks(ctx, client, namespace, networks, usedNetworks)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+
+		changes, err = planPruneSecrets(ctx, client, namespace, secrets, usedSecrets)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	return plan, nil
+}
+
+func planBundle(ctx context.Context, client StackClient, events EventSink, opts deployOptions) (*Plan, error) {
+	bundle, err := loadBundlefile(events, opts.resolvePath(opts.bundlefile))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDaemonIsSwarmManager(ctx, client); err != nil {
+		return nil, err
+	}
+
+	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
+	plan := &Plan{Namespace: opts.namespace, Changes: []PlanChange{}}
+
+	if opts.prune {
+		services := map[string]struct{}{}
+		for service := range bundle.Services {
+			services[service] = struct{}{}
+		}
+		changes, err := planPruneServices(ctx, client, namespace, services)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	networks := convertBundleNetworks(namespace, bundle)
+	changes, err := planNetworks(ctx, client, namespace, networks)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	services := convertBundleServices(namespace, bundle)
+	changes, err = planServices(ctx, client, namespace, services)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, changes...)
+
+	if opts.prune {
+		usedNetworks, _, err := getPlannedUsage(ctx, client, namespace, services, opts.prune)
+		if err != nil {
+			return nil, err
+		}
+		changes, err = planPruneNetworks(ctx, client, namespace, networks, usedNetworks)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, changes...)
+	}
+
+	return plan, nil
+}
+
+// planPruneServices lists the stack services that the deploy would prune, as selected by selectPrunedServices
+func planPruneServices(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, services map[string]struct{}) ([]PlanChange, error) {
+	oldServices, err := getStackServices(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for _, service := range selectPrunedServices(namespace, oldServices, services) {
+		changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SERVICE, Name: service.Spec.Name, Action: RESOURCE_ACTION_REMOVE})
+	}
+	return changes, nil
+}
+
+// planPruneNetworks lists the stack networks that the deploy would prune, as selected by selectPrunedNetworks
+func planPruneNetworks(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, networks map[string]docker_api_types.NetworkCreate, used map[string]bool) ([]PlanChange, error) {
+	oldNetworks, err := getStackNetworks(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for _, network := range selectPrunedNetworks(namespace, oldNetworks, networks, used) {
+		changes = append(changes, PlanChange{Kind: RESOURCE_KIND_NETWORK, Name: network.Name, Action: RESOURCE_ACTION_REMOVE})
+	}
+	return changes, nil
+}
+
+// planUnusedSecretVersions lists the old secret versions that the deploy would remove, as selected by selectUnusedSecretVersions
+func planUnusedSecretVersions(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, secrets []docker_api_types_swarm.SecretSpec, used map[string]bool) ([]PlanChange, error) {
+	stackSecrets, err := getStackSecrets(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for _, secret := range selectUnusedSecretVersions(stackSecrets, secrets, used) {
+		changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE})
+	}
+	return changes, nil
+}
+
+// planPruneSecrets lists the stack secrets that the deploy would prune, as selected by selectPrunedSecrets
+func planPruneSecrets(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, secrets []docker_api_types_swarm.SecretSpec, used map[string]bool) ([]PlanChange, error) {
+	oldSecrets, err := getStackSecrets(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for _, secret := range selectPrunedSecrets(oldSecrets, secrets, used) {
+		changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE})
+	}
+	return changes, nil
+}
+
+// getPlannedUsage collects the networks and secrets that services would use once the stack is deployed, like getUsage does for the services as they are now.
+//
+// A stack service that the deploy updates moves its current spec to its
+// previous spec, and a pruned service uses nothing. Services that don't
+// exist yet only use resources by name.
+func getPlannedUsage(
+	ctx context.Context,
+	client StackClient,
+	namespace docker_cli_compose_convert.Namespace,
+	services map[string]docker_api_types_swarm.ServiceSpec,
+	prune bool,
+) (map[string]bool, map[string]bool, error) {
+	existingServices, err := client.ServiceList(ctx, docker_api_types.ServiceListOptions{})
+	if err != nil {
+		return nil, nil, newResourceError(RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+	networkIds, err := getNetworkIds(ctx, client)
+	if err != nil {
+		return nil, nil, newResourceError(RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	usage := newResourceUsage()
+	deployed := map[string]bool{}
+	for _, service := range existingServices {
+		spec, previousSpec := service.Spec, service.PreviousSpec
+		if service.Spec.Labels[docker_cli_compose_convert.LabelNamespace] == namespace.Name() {
+			internalName := namespace.Descope(service.Spec.Name)
+			desired, found := services[internalName]
+			switch {
+			case found:
+				deployed[internalName] = true
+				if len(serviceSpecChanges(service.Spec, desired, networkIds)) > 0 {
+					spec, previousSpec = desired, &service.Spec
+				}
+			case prune:
+				continue
+			}
+		}
+		usage.add(&spec, previousSpec)
+	}
+	for internalName, spec := range services {
+		if !deployed[internalName] {
+			spec := spec
+			usage.add(&spec, nil)
+		}
+	}
+	return usage.networks, usage.secrets, nil
+}
+
+// planNetworks lists the stack networks that the deploy would create, as selected by selectMissingNetworks
+func planNetworks(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, networks map[string]docker_api_types.NetworkCreate) ([]PlanChange, error) {
+	existingNetworks, err := getStackNetworks(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for _, internalName := range selectMissingNetworks(namespace, existingNetworks, networks) {
+		changes = append(changes, PlanChange{Kind: RESOURCE_KIND_NETWORK, Name: namespace.Scope(internalName), Action: RESOURCE_ACTION_CREATE})
+	}
+	return changes, nil
+}
+
+// planSecrets lists which secret versions would be created, and which would have their labels updated
+func planSecrets(ctx context.Context, client StackClient, secrets []docker_api_types_swarm.SecretSpec) ([]PlanChange, error) {
+	changes := []PlanChange{}
+	for _, secretSpec := range secrets {
+		secret, _, err := client.SecretInspectWithRaw(ctx, secretSpec.Name)
+		switch {
+		case err == nil:
+			if !labelsEqual(secret.Spec.Labels, secretSpec.Labels) {
+				changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_UPDATE})
+			}
+		case docker_client.IsErrNotFound(err):
+			changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SECRET, Name: secretSpec.Name, Action: RESOURCE_ACTION_CREATE})
+		default:
+			return nil, newResourceError(RESOURCE_KIND_SECRET, secretSpec.Name, RESOURCE_ACTION_INSPECT, err)
+		}
+	}
+	sortPlanChanges(changes)
+	return changes, nil
+}
+
+// planServices lists which services would be created, and which would be updated along with the fields that would change
+func planServices(ctx context.Context, client StackClient, namespace docker_cli_compose_convert.Namespace, services map[string]docker_api_types_swarm.ServiceSpec) ([]PlanChange, error) {
+	existingServices, err := getStackServices(ctx, client, namespace.Name())
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	existingServiceMap := make(map[string]docker_api_types_swarm.Service)
+	for _, service := range existingServices {
+		existingServiceMap[service.Spec.Name] = service
+	}
+
+	networkIds, err := getNetworkIds(ctx, client)
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_NETWORK, namespace.Name(), RESOURCE_ACTION_LIST, err)
+	}
+
+	changes := []PlanChange{}
+	for internalName, serviceSpec := range services {
+		name := namespace.Scope(internalName)
+		if service, exists := existingServiceMap[name]; exists {
+			// unchanged services are left alone by the deploy, so they aren't part of the plan
+			if diff := serviceSpecChanges(service.Spec, serviceSpec, networkIds); len(diff) > 0 {
+				changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_UPDATE, Diff: diff})
+			}
+		} else {
+			changes = append(changes, PlanChange{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_CREATE})
+		}
+	}
+	sortPlanChanges(changes)
+	return changes, nil
+}
+
+func sortPlanChanges(changes []PlanChange) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+}
+
+// PlanProperty holds the plan for a stack deploy
+type PlanProperty struct {
+	val *Plan
+}
+
+func (pp *PlanProperty) Property() api.Property {
+	return api.Property(pp)
+}
+
+func (pp *PlanProperty) Id() string {
+	return PROPERTY_ID_STACK_PLAN
+}
+
+func (pp *PlanProperty) Type() string {
+	return "*stack.Plan"
+}
+
+func (pp *PlanProperty) Ui() api.Ui {
+	return base.NewUi(
+		pp.Id(),
+		"Stack plan",
+		"Changes that deploying the stack would make",
+		"",
+	)
+}
+
+func (pp *PlanProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (pp *PlanProperty) Validate() bool {
+	return pp.val != nil
+}
+
+func (pp *PlanProperty) Get() interface{} {
+	return interface{}(pp.val)
+}
+
+func (pp *PlanProperty) Set(val interface{}) error {
+	if typedVal, success := val.(*Plan); success {
+		pp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("PlanProperty expects a *Plan value")
+	}
+}
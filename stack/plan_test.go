@@ -0,0 +1,232 @@
+package stack
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func findPlanChange(plan *Plan, kind, name string) (PlanChange, bool) {
+	for _, change := range plan.Changes {
+		if change.Kind == kind && change.Name == name {
+			return change, true
+		}
+	}
+	return PlanChange{}, false
+}
+
+func TestRunPlanDoesNotChangeTheSwarm(t *testing.T) {
+	ctx := context.Background()
+	dir := writeComposefile(t, `
+version: "3.1"
+services:
+  web:
+    image: nginx:1.13
+    secrets:
+      - token
+  db:
+    image: postgres
+secrets:
+  token:
+    file: ./token.txt
+`)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "token.txt"), []byte("s3cret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	for _, spec := range []docker_api_types_swarm.ServiceSpec{
+		testServiceSpec(namespace, "web", "nginx:1.12"),
+		testServiceSpec(namespace, "old", "busybox"),
+	} {
+		if _, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := len(swarm.Calls())
+
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+	opts.prune = true
+	events := &recordingEventSink{}
+
+	plan, err := runPlan(ctx, swarm, events, opts)
+	if err != nil {
+		t.Fatalf("Unexpected plan error: %s", err)
+	}
+
+	for _, call := range swarm.Calls()[before:] {
+		switch call {
+		case fakeswarm.METHOD_SERVICE_CREATE, fakeswarm.METHOD_SERVICE_UPDATE, fakeswarm.METHOD_SERVICE_REMOVE,
+			fakeswarm.METHOD_NETWORK_CREATE, fakeswarm.METHOD_SECRET_CREATE, fakeswarm.METHOD_SECRET_UPDATE:
+			t.Errorf("Planning changed the swarm with %s", call)
+		}
+	}
+
+	expected := map[string]string{
+		"test_old":     RESOURCE_ACTION_REMOVE,
+		"test_default": RESOURCE_ACTION_CREATE,
+		"test_db":      RESOURCE_ACTION_CREATE,
+		"test_web":     RESOURCE_ACTION_UPDATE,
+	}
+	expected[testSecretVersion("test_token", "s3cret")] = RESOURCE_ACTION_CREATE
+	if len(plan.Changes) != len(expected) {
+		t.Errorf("Expected %d planned changes, got: %#v", len(expected), plan.Changes)
+	}
+	for _, change := range plan.Changes {
+		if expected[change.Name] != change.Action {
+			t.Errorf("Expected %s to be planned as %q, got %q", change.Name, expected[change.Name], change.Action)
+		}
+		if !events.find(change.Kind, change.Name, change.Action, EVENT_STATUS_PLANNED) {
+			t.Errorf("No planned event was emitted for %s %s", change.Kind, change.Name)
+		}
+	}
+
+	web, _ := findPlanChange(plan, RESOURCE_KIND_SERVICE, "test_web")
+	found := false
+	for _, diff := range web.Diff {
+		if diff.Field == "TaskTemplate.ContainerSpec.Image" {
+			found = true
+			if diff.Old != `"nginx:1.12"` || diff.New != `"nginx:1.13"` {
+				t.Errorf("Unexpected image diff: %s", diff)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("The image change is missing from the diff of test_web: %#v", web.Diff)
+	}
+}
+
+func TestPlanSecretsSeparatesCreatesFromUpdates(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	for _, name := range []string{"test_relabelled", "test_unchanged"} {
+		if _, err := swarm.SecretCreate(ctx, docker_api_types_swarm.SecretSpec{Annotations: docker_api_types_swarm.Annotations{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := planSecrets(ctx, swarm, []docker_api_types_swarm.SecretSpec{
+		{Annotations: docker_api_types_swarm.Annotations{Name: "test_relabelled", Labels: map[string]string{"tier": "back"}}},
+		{Annotations: docker_api_types_swarm.Annotations{Name: "test_unchanged"}},
+		{Annotations: docker_api_types_swarm.Annotations{Name: "test_new"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected plan error: %s", err)
+	}
+	if len(changes) != 2 || changes[0].Action != RESOURCE_ACTION_CREATE || changes[1].Action != RESOURCE_ACTION_UPDATE {
+		t.Errorf("Expected test_relabelled to be updated, test_new to be created and test_unchanged to be left out: %#v", changes)
+	}
+}
+
+func TestRunPlanListsPrunedNetworksAndSecrets(t *testing.T) {
+	ctx := context.Background()
+	dir := writeComposefile(t, `
+version: "3.1"
+services:
+  web:
+    image: nginx
+    networks:
+      - front
+    secrets:
+      - token
+  worker:
+    image: busybox
+    networks:
+      - back
+    secrets:
+      - key
+networks:
+  front:
+  back:
+secrets:
+  token:
+    file: ./token.txt
+  key:
+    file: ./key.txt
+`)
+	defer os.RemoveAll(dir)
+	writeFile := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	swarm := fakeswarm.NewSwarm()
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+	opts.prune = true
+
+	writeFile("key.txt", "k3y")
+	for _, token := range []string{"first", "second"} {
+		writeFile("token.txt", token)
+		if _, err := runDeploy(ctx, swarm, &recordingEventSink{}, noRegistryAuth, opts); err != nil {
+			t.Fatalf("Unexpected deploy error: %s", err)
+		}
+	}
+
+	// the worker, with its network and secret, is dropped, and the token changes again
+	writeFile(defaultComposefile, `
+version: "3.1"
+services:
+  web:
+    image: nginx
+    networks:
+      - front
+    secrets:
+      - token
+networks:
+  front:
+secrets:
+  token:
+    file: ./token.txt
+`)
+	writeFile("token.txt", "third")
+
+	plan, err := runPlan(ctx, swarm, &recordingEventSink{}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected plan error: %s", err)
+	}
+	planned := map[string]bool{}
+	for _, change := range plan.Changes {
+		if change.Action == RESOURCE_ACTION_REMOVE {
+			planned[change.Kind+" "+change.Name] = true
+		}
+	}
+
+	// the second token version is kept, as it is the previous spec of the web service
+	expected := map[string]bool{
+		RESOURCE_KIND_SERVICE + " test_worker":                                true,
+		RESOURCE_KIND_NETWORK + " test_back":                                  true,
+		RESOURCE_KIND_SECRET + " " + testSecretVersion("test_key", "k3y"):     true,
+		RESOURCE_KIND_SECRET + " " + testSecretVersion("test_token", "first"): true,
+	}
+	if !reflect.DeepEqual(planned, expected) {
+		t.Errorf("Expected the plan to remove %v, got %v", expected, planned)
+	}
+
+	events := &recordingEventSink{}
+	if _, err := runDeploy(ctx, swarm, events, noRegistryAuth, opts); err != nil {
+		t.Fatalf("Unexpected deploy error: %s", err)
+	}
+	removed := map[string]bool{}
+	for _, event := range events.events {
+		if event.Action == RESOURCE_ACTION_REMOVE && event.Status == EVENT_STATUS_SUCCEEDED {
+			removed[event.Kind+" "+event.Name] = true
+		}
+	}
+	if !reflect.DeepEqual(removed, planned) {
+		t.Errorf("The plan removes %v, but the deploy removed %v", planned, removed)
+	}
+}
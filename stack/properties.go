@@ -0,0 +1,526 @@
+package stack
+
+import (
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+	base_property "github.com/CoachApplication/base/property"
+)
+
+const (
+	PROPERTY_ID_STACK_NAMESPACE        = "stack.namespace"
+	PROPERTY_ID_STACK_COMPOSEFILES     = "stack.composefiles"
+	PROPERTY_ID_STACK_BUNDLEFILE       = "stack.bundlefile"
+	PROPERTY_ID_STACK_SENDREGISTRYAUTH = "stack.sendregistryauth"
+	PROPERTY_ID_STACK_PRUNE            = "stack.prune"
+	PROPERTY_ID_STACK_WAIT             = "stack.wait"
+	PROPERTY_ID_STACK_WAITTIMEOUT      = "stack.waittimeout"
+	PROPERTY_ID_STACK_DRYRUN           = "stack.dryrun"
+	PROPERTY_ID_STACK_PARALLELISM      = "stack.parallelism"
+	PROPERTY_ID_STACK_ROLLBACK         = "stack.rollback"
+	PROPERTY_ID_STACK_FILTERS          = "stack.filters"
+	PROPERTY_ID_STACK_SERVICE          = "stack.service"
+	PROPERTY_ID_STACK_FOLLOW           = "stack.follow"
+	PROPERTY_ID_STACK_SINCE            = "stack.since"
+	PROPERTY_ID_STACK_TAIL             = "stack.tail"
+	PROPERTY_ID_STACK_TIMESTAMPS       = "stack.timestamps"
+	PROPERTY_ID_STACK_SCALES           = "stack.scales"
+)
+
+// NamespaceProperty is the name of the stack, used to scope and label all stack resources
+type NamespaceProperty struct {
+	base_property.StringProperty
+}
+
+func (np *NamespaceProperty) Property() api.Property {
+	return api.Property(np)
+}
+
+func (np *NamespaceProperty) Id() string {
+	return PROPERTY_ID_STACK_NAMESPACE
+}
+
+func (np *NamespaceProperty) Ui() api.Ui {
+	return base.NewUi(
+		np.Id(),
+		"Stack namespace",
+		"Name of the stack, used to scope all stack services, networks and secrets",
+		"",
+	)
+}
+
+func (np *NamespaceProperty) Usage() api.Usage {
+	return (&base.RequiredPropertyUsage{}).Usage()
+}
+
+// ComposefilesProperty is an ordered list of paths to compose files which describe the stack, later files override earlier ones
+type ComposefilesProperty struct {
+	base_property.StringSliceProperty
+}
+
+func (cp *ComposefilesProperty) Property() api.Property {
+	return api.Property(cp)
+}
+
+func (cp *ComposefilesProperty) Id() string {
+	return PROPERTY_ID_STACK_COMPOSEFILES
+}
+
+func (cp *ComposefilesProperty) Ui() api.Ui {
+	return base.NewUi(
+		cp.Id(),
+		"Compose files",
+		"Paths to Compose files which describe the stack, merged in order (defaults to docker-compose.yml)",
+		"",
+	)
+}
+
+func (cp *ComposefilesProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// BundlefileProperty is the path to a distributed application bundle file which describes the stack
+type BundlefileProperty struct {
+	base_property.StringProperty
+}
+
+func (bp *BundlefileProperty) Property() api.Property {
+	return api.Property(bp)
+}
+
+func (bp *BundlefileProperty) Id() string {
+	return PROPERTY_ID_STACK_BUNDLEFILE
+}
+
+func (bp *BundlefileProperty) Ui() api.Ui {
+	return base.NewUi(
+		bp.Id(),
+		"Bundle file",
+		"Path to a Distributed Application Bundle file which describes the stack",
+		"",
+	)
+}
+
+func (bp *BundlefileProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// SendRegistryAuthProperty sends registry authentication details to the swarm agents
+type SendRegistryAuthProperty struct {
+	base_property.BooleanProperty
+}
+
+func (srap *SendRegistryAuthProperty) Property() api.Property {
+	return api.Property(srap)
+}
+
+func (srap *SendRegistryAuthProperty) Id() string {
+	return PROPERTY_ID_STACK_SENDREGISTRYAUTH
+}
+
+func (srap *SendRegistryAuthProperty) Ui() api.Ui {
+	return base.NewUi(
+		srap.Id(),
+		"Send registry authentication",
+		"Send registry authentication details to Swarm agents",
+		"",
+	)
+}
+
+func (srap *SendRegistryAuthProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// PruneProperty removes stack services that are no longer referenced in the stack source
+type PruneProperty struct {
+	base_property.BooleanProperty
+}
+
+func (pp *PruneProperty) Property() api.Property {
+	return api.Property(pp)
+}
+
+func (pp *PruneProperty) Id() string {
+	return PROPERTY_ID_STACK_PRUNE
+}
+
+func (pp *PruneProperty) Ui() api.Ui {
+	return base.NewUi(
+		pp.Id(),
+		"Prune",
+		"Prune services, networks and secrets that are no longer referenced",
+		"",
+	)
+}
+
+func (pp *PruneProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// WaitProperty makes a deploy wait until all stack services have converged on their new spec
+type WaitProperty struct {
+	base_property.BooleanProperty
+}
+
+func (wp *WaitProperty) Property() api.Property {
+	return api.Property(wp)
+}
+
+func (wp *WaitProperty) Id() string {
+	return PROPERTY_ID_STACK_WAIT
+}
+
+func (wp *WaitProperty) Ui() api.Ui {
+	return base.NewUi(
+		wp.Id(),
+		"Wait for convergence",
+		"Wait until the tasks of all deployed services are running, and fail if a service update fails or rolls back",
+		"",
+	)
+}
+
+func (wp *WaitProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// WaitTimeoutProperty is how many seconds a deploy waits for services to converge
+type WaitTimeoutProperty struct {
+	base_property.IntProperty
+}
+
+func (wtp *WaitTimeoutProperty) Property() api.Property {
+	return api.Property(wtp)
+}
+
+func (wtp *WaitTimeoutProperty) Id() string {
+	return PROPERTY_ID_STACK_WAITTIMEOUT
+}
+
+func (wtp *WaitTimeoutProperty) Ui() api.Ui {
+	return base.NewUi(
+		wtp.Id(),
+		"Convergence timeout",
+		"Seconds to wait for services to converge, before the deploy is failed",
+		"",
+	)
+}
+
+func (wtp *WaitTimeoutProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// DryRunProperty makes a deploy only plan its changes, without making them
+type DryRunProperty struct {
+	base_property.BooleanProperty
+}
+
+func (drp *DryRunProperty) Property() api.Property {
+	return api.Property(drp)
+}
+
+func (drp *DryRunProperty) Id() string {
+	return PROPERTY_ID_STACK_DRYRUN
+}
+
+func (drp *DryRunProperty) Ui() api.Ui {
+	return base.NewUi(
+		drp.Id(),
+		"Dry run",
+		"List the changes that the deploy would make to the stack, without making them",
+		"",
+	)
+}
+
+func (drp *DryRunProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// ParallelismProperty is how many stack resources are changed at the same time
+type ParallelismProperty struct {
+	base_property.IntProperty
+}
+
+func (pp *ParallelismProperty) Property() api.Property {
+	return api.Property(pp)
+}
+
+func (pp *ParallelismProperty) Id() string {
+	return PROPERTY_ID_STACK_PARALLELISM
+}
+
+func (pp *ParallelismProperty) Ui() api.Ui {
+	return base.NewUi(
+		pp.Id(),
+		"Parallelism",
+		"How many services and secrets are created, updated or removed at the same time",
+		"",
+	)
+}
+
+func (pp *ParallelismProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// RollbackProperty makes a failed deploy roll back the services that it changed
+type RollbackProperty struct {
+	base_property.BooleanProperty
+}
+
+func (rp *RollbackProperty) Property() api.Property {
+	return api.Property(rp)
+}
+
+func (rp *RollbackProperty) Id() string {
+	return PROPERTY_ID_STACK_ROLLBACK
+}
+
+func (rp *RollbackProperty) Ui() api.Ui {
+	return base.NewUi(
+		rp.Id(),
+		"Rollback on failure",
+		"If the deploy fails, or services fail to converge, put updated services back on their previous spec and remove created services",
+		"",
+	)
+}
+
+func (rp *RollbackProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// FiltersProperty narrows a listing with "key=value" filters, as accepted by the docker CLI
+type FiltersProperty struct {
+	base_property.StringSliceProperty
+}
+
+func (fp *FiltersProperty) Property() api.Property {
+	return api.Property(fp)
+}
+
+func (fp *FiltersProperty) Id() string {
+	return PROPERTY_ID_STACK_FILTERS
+}
+
+func (fp *FiltersProperty) Ui() api.Ui {
+	return base.NewUi(
+		fp.Id(),
+		"Filters",
+		"Filters such as name=web, desired-state=running or node=worker1, which narrow the services and tasks listed",
+		"",
+	)
+}
+
+func (fp *FiltersProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// ServiceProperty is the name of a single stack service, without the stack namespace
+type ServiceProperty struct {
+	base_property.StringProperty
+}
+
+func (sp *ServiceProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *ServiceProperty) Id() string {
+	return PROPERTY_ID_STACK_SERVICE
+}
+
+func (sp *ServiceProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Service",
+		"Name of a single service of the stack, as it appears in the compose file; all services are used if left empty",
+		"",
+	)
+}
+
+func (sp *ServiceProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// FollowProperty keeps streaming logs as they are written
+type FollowProperty struct {
+	base_property.BooleanProperty
+}
+
+func (fp *FollowProperty) Property() api.Property {
+	return api.Property(fp)
+}
+
+func (fp *FollowProperty) Id() string {
+	return PROPERTY_ID_STACK_FOLLOW
+}
+
+func (fp *FollowProperty) Ui() api.Ui {
+	return base.NewUi(
+		fp.Id(),
+		"Follow",
+		"Keep streaming new log output until the operation is stopped",
+		"",
+	)
+}
+
+func (fp *FollowProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// SinceProperty only shows logs written after a point in time
+type SinceProperty struct {
+	base_property.StringProperty
+}
+
+func (sp *SinceProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *SinceProperty) Id() string {
+	return PROPERTY_ID_STACK_SINCE
+}
+
+func (sp *SinceProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Since",
+		"Only show logs since a timestamp such as 2017-06-01T12:00:00, or a relative time such as 10m",
+		"",
+	)
+}
+
+func (sp *SinceProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// TailProperty is how many lines to show from the end of the logs of each task
+type TailProperty struct {
+	base_property.StringProperty
+}
+
+func (tp *TailProperty) Property() api.Property {
+	return api.Property(tp)
+}
+
+func (tp *TailProperty) Id() string {
+	return PROPERTY_ID_STACK_TAIL
+}
+
+func (tp *TailProperty) Ui() api.Ui {
+	return base.NewUi(
+		tp.Id(),
+		"Tail",
+		"Number of lines to show from the end of the logs, or \"all\"",
+		"",
+	)
+}
+
+func (tp *TailProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// TimestampsProperty adds the time that each log line was written
+type TimestampsProperty struct {
+	base_property.BooleanProperty
+}
+
+func (tp *TimestampsProperty) Property() api.Property {
+	return api.Property(tp)
+}
+
+func (tp *TimestampsProperty) Id() string {
+	return PROPERTY_ID_STACK_TIMESTAMPS
+}
+
+func (tp *TimestampsProperty) Ui() api.Ui {
+	return base.NewUi(
+		tp.Id(),
+		"Timestamps",
+		"Show the time that each log line was written",
+		"",
+	)
+}
+
+func (tp *TimestampsProperty) Usage() api.Usage {
+	return (&base.OptionalPropertyUsage{}).Usage()
+}
+
+// ScalesProperty is a list of "service=replicas" pairs, naming services without the stack namespace
+type ScalesProperty struct {
+	base_property.StringSliceProperty
+}
+
+func (sp *ScalesProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *ScalesProperty) Id() string {
+	return PROPERTY_ID_STACK_SCALES
+}
+
+func (sp *ScalesProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Scales",
+		"Replicas to run for stack services, such as web=3 or worker=0",
+		"",
+	)
+}
+
+func (sp *ScalesProperty) Usage() api.Usage {
+	return (&base.RequiredPropertyUsage{}).Usage()
+}
+
+// propertyString retrieves a string value from a property, if it exists in the properties
+func propertyString(props api.Properties, id string) (string, bool) {
+	if prop, err := props.Get(id); err == nil {
+		if val, ok := prop.Get().(string); ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// propertyStrings retrieves a string slice value from a property, if it exists in the properties
+func propertyStrings(props api.Properties, id string) ([]string, bool) {
+	if prop, err := props.Get(id); err == nil {
+		if val, ok := prop.Get().([]string); ok {
+			return val, true
+		}
+	}
+	return []string{}, false
+}
+
+// propertyBool retrieves a bool value from a property, if it exists in the properties
+func propertyBool(props api.Properties, id string) (bool, bool) {
+	if prop, err := props.Get(id); err == nil {
+		if val, ok := prop.Get().(bool); ok {
+			return val, true
+		}
+	}
+	return false, false
+}
+
+// propertyInt retrieves an int value from a property, if it exists in the properties
+func propertyInt(props api.Properties, id string) (int, bool) {
+	if prop, err := props.Get(id); err == nil {
+		if val, ok := prop.Get().(int); ok {
+			return val, true
+		}
+	}
+	return 0, false
+}
+
+// resultFromErrors builds a finished result which is failed if any errors were passed
+func resultFromErrors(errs []error) api.Result {
+	res := base.NewResult()
+
+	for _, err := range errs {
+		res.AddError(err)
+	}
+	if len(errs) > 0 {
+		res.MarkFailed()
+	} else {
+		res.MarkSucceeded()
+	}
+	res.MarkFinished()
+
+	return res.Result()
+}
@@ -3,53 +3,223 @@ package stack
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
 
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
 	docker_api_types "github.com/docker/docker/api/types"
 	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
-	docker_cli_command "github.com/docker/docker/cli/command"
 )
 
+const (
+	defaultTaskWaitTimeout = 2 * time.Minute
+	taskPollInterval       = time.Second
+)
+
+type removeOptions struct {
+	namespace       string
+	taskWaitTimeout time.Duration
+	parallelism     int
+}
+
+// newRemoveOptionsDefault provides remove options for the stack in the current directory
+func newRemoveOptionsDefault() removeOptions {
+	wd, _ := os.Getwd()
+	return newRemoveOptionsForProject(wd)
+}
+
+// newRemoveOptionsForProject provides remove options for the stack of a project
+func newRemoveOptionsForProject(projectRoot string) removeOptions {
+	return removeOptions{
+		namespace:       namespaceFromPath(projectRoot),
+		taskWaitTimeout: defaultTaskWaitTimeout,
+		parallelism:     defaultParallelism,
+	}
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts removeOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	namespaceProp := &NamespaceProperty{}
+	namespaceProp.Set(opts.namespace)
+	props.Add(namespaceProp.Property())
+
+	parallelismProp := &ParallelismProperty{}
+	parallelismProp.Set(opts.parallelism)
+	props.Add(parallelismProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts removeOptions) withProperties(props api.Properties) removeOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_NAMESPACE); ok {
+		opts.namespace = val
+	}
+	if val, ok := propertyInt(props, PROPERTY_ID_STACK_PARALLELISM); ok {
+		opts.parallelism = val
+	}
+	return opts
+}
+
+// validate checks that the options describe a removable stack
+func (opts removeOptions) validate() []error {
+	errs := []error{}
+
+	if err := validateNamespace(opts.namespace); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateParallelism(opts.parallelism); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// runRemove removes all services, secrets and networks labelled with the stack namespace
+func runRemove(ctx context.Context, client StackClient, events EventSink, opts removeOptions) []error {
+	namespace := opts.namespace
+
+	services, err := getStackServices(ctx, client, namespace)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SERVICE, namespace, RESOURCE_ACTION_LIST, err)}
+	}
+
+	networks, err := getStackNetworks(ctx, client, namespace)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_NETWORK, namespace, RESOURCE_ACTION_LIST, err)}
+	}
+
+	secrets, err := getStackSecrets(ctx, client, namespace)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SECRET, namespace, RESOURCE_ACTION_LIST, err)}
+	}
+
+	if len(services)+len(networks)+len(secrets) == 0 {
+		events.Emit(Event{Kind: RESOURCE_KIND_STACK, Name: namespace, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_INFO, Message: "Nothing found in stack: " + namespace})
+		return nil
+	}
+
+	removed, errs := removeServices(ctx, client, events, services, opts.parallelism)
+	if len(removed) > 0 {
+		// networks can't be removed while tasks still hold endpoints on them; the tasks of services that failed to be removed never stop
+		events.Emit(Event{Kind: RESOURCE_KIND_STACK, Name: namespace, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_INFO, Message: "Waiting for the tasks of stack " + namespace + " to stop"})
+		if err := waitOnTasks(ctx, client, namespace, removed, opts.taskWaitTimeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, removeSecrets(ctx, client, events, secrets)...)
+	errs = append(errs, removeNetworks(ctx, client, events, networks)...)
+
+	return errs
+}
+
+// waitOnTasks polls the tasks of the removed stack services until all of them have reached a terminal state
+func waitOnTasks(ctx context.Context, apiclient StackClient, namespace string, serviceIds map[string]bool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		tasks, err := getStackTasks(ctx, apiclient, namespace)
+		if err != nil {
+			return err
+		}
+
+		running := 0
+		for _, task := range tasks {
+			if serviceIds[task.ServiceID] && !isTerminalTaskState(task.Status.State) {
+				running++
+			}
+		}
+		if running == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for %d tasks of stack %s to stop", running, namespace)
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+func isTerminalTaskState(state docker_api_types_swarm.TaskState) bool {
+	switch state {
+	case docker_api_types_swarm.TaskStateComplete,
+		docker_api_types_swarm.TaskStateShutdown,
+		docker_api_types_swarm.TaskStateFailed,
+		docker_api_types_swarm.TaskStateRejected:
+		return true
+	}
+	return false
+}
+
+// removeServices removes each service, in parallel, providing the ids of the removed services and an error for every service that could not be removed
 func removeServices(
 	ctx context.Context,
-	dockerCli docker_cli_command.Cli,
+	client StackClient,
+	events EventSink,
 	services []docker_api_types_swarm.Service,
-) bool {
-	var err error
-	for _, service := range services {
-		fmt.Fprintf(dockerCli.Err(), "Removing service %s\n", service.Spec.Name)
-		if err = dockerCli.Client().ServiceRemove(ctx, service.ID); err != nil {
-			fmt.Fprintf(dockerCli.Err(), "Failed to remove service %s: %s", service.ID, err)
+	parallelism int,
+) (map[string]bool, []error) {
+	sorted := append([]docker_api_types_swarm.Service{}, services...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Spec.Name < sorted[j].Spec.Name })
+
+	var lock sync.Mutex
+	removed := map[string]bool{}
+	errs := runParallel(len(sorted), parallelism, events, func(i int, events EventSink) error {
+		service := sorted[i]
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: service.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_STARTED})
+		if err := client.ServiceRemove(ctx, service.ID); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, service.Spec.Name, RESOURCE_ACTION_REMOVE, err)
 		}
-	}
-	return err != nil
+		lock.Lock()
+		removed[service.ID] = true
+		lock.Unlock()
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: service.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_SUCCEEDED})
+		return nil
+	})
+	return removed, errs
 }
 
+// removeNetworks removes each network, returning an error for every network that could not be removed
 func removeNetworks(
 	ctx context.Context,
-	dockerCli docker_cli_command.Cli,
+	client StackClient,
+	events EventSink,
 	networks []docker_api_types.NetworkResource,
-) bool {
-	var err error
+) []error {
+	errs := []error{}
 	for _, network := range networks {
-		fmt.Fprintf(dockerCli.Err(), "Removing network %s\n", network.Name)
-		if err = dockerCli.Client().NetworkRemove(ctx, network.ID); err != nil {
-			fmt.Fprintf(dockerCli.Err(), "Failed to remove network %s: %s", network.ID, err)
+		events.Emit(Event{Kind: RESOURCE_KIND_NETWORK, Name: network.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_STARTED})
+		if err := client.NetworkRemove(ctx, network.ID); err != nil {
+			errs = append(errs, reportResourceError(events, RESOURCE_KIND_NETWORK, network.Name, RESOURCE_ACTION_REMOVE, err))
+			continue
 		}
+		events.Emit(Event{Kind: RESOURCE_KIND_NETWORK, Name: network.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_SUCCEEDED})
 	}
-	return err != nil
+	return errs
 }
 
+// removeSecrets removes each secret, returning an error for every secret that could not be removed
 func removeSecrets(
 	ctx context.Context,
-	dockerCli docker_cli_command.Cli,
+	client StackClient,
+	events EventSink,
 	secrets []docker_api_types_swarm.Secret,
-) bool {
-	var err error
+) []error {
+	errs := []error{}
 	for _, secret := range secrets {
-		fmt.Fprintf(dockerCli.Err(), "Removing secret %s\n", secret.Spec.Name)
-		if err = dockerCli.Client().SecretRemove(ctx, secret.ID); err != nil {
-			fmt.Fprintf(dockerCli.Err(), "Failed to remove secret %s: %s", secret.ID, err)
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_STARTED})
+		if err := client.SecretRemove(ctx, secret.ID); err != nil {
+			errs = append(errs, reportResourceError(events, RESOURCE_KIND_SECRET, secret.Spec.Name, RESOURCE_ACTION_REMOVE, err))
+			continue
 		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_SUCCEEDED})
 	}
-	return err != nil
+	return errs
 }
@@ -0,0 +1,112 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func TestRunRemoveRemovesOnlyStackResources(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	labels := docker_cli_compose_convert.AddStackLabel(namespace, nil)
+
+	created, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, "web", "nginx"), docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swarm.AddTask(docker_api_types_swarm.Task{
+		ServiceID:   created.ID,
+		Annotations: docker_api_types_swarm.Annotations{Labels: labels},
+		Status:      docker_api_types_swarm.TaskStatus{State: docker_api_types_swarm.TaskStateRunning},
+	})
+	if _, err := swarm.NetworkCreate(ctx, "test_default", docker_api_types.NetworkCreate{Driver: "overlay", Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := swarm.SecretCreate(ctx, docker_api_types_swarm.SecretSpec{Annotations: docker_api_types_swarm.Annotations{Name: "test_token", Labels: labels}}); err != nil {
+		t.Fatal(err)
+	}
+	swarm.AddNetwork(docker_api_types.NetworkResource{Name: "shared", Scope: "swarm"})
+
+	opts := removeOptions{namespace: "test", taskWaitTimeout: time.Second, parallelism: defaultParallelism}
+	if errs := runRemove(ctx, swarm, &recordingEventSink{}, opts); len(errs) > 0 {
+		t.Fatalf("Unexpected remove errors: %s", StackErrors(errs))
+	}
+
+	if services := swarm.Services(); len(services) > 0 {
+		t.Errorf("Stack services were not removed: %#v", services)
+	}
+	if secrets := swarm.Secrets(); len(secrets) > 0 {
+		t.Errorf("Stack secrets were not removed: %#v", secrets)
+	}
+	if networks := swarm.Networks(); len(networks) != 1 || networks[0].Name != "shared" {
+		t.Errorf("Expected only the network outside of the stack to remain: %#v", networks)
+	}
+}
+
+func TestRunRemoveCollectsFailures(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	labels := docker_cli_compose_convert.AddStackLabel(namespace, nil)
+
+	if _, err := swarm.NetworkCreate(ctx, "test_default", docker_api_types.NetworkCreate{Driver: "overlay", Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := swarm.SecretCreate(ctx, docker_api_types_swarm.SecretSpec{Annotations: docker_api_types_swarm.Annotations{Name: "test_token", Labels: labels}}); err != nil {
+		t.Fatal(err)
+	}
+	swarm.FailOn(fakeswarm.METHOD_SECRET_REMOVE, errors.New("secret is in use"))
+
+	opts := removeOptions{namespace: "test", taskWaitTimeout: time.Second, parallelism: defaultParallelism}
+	errs := runRemove(ctx, swarm, &recordingEventSink{}, opts)
+	if len(errs) != 1 {
+		t.Fatalf("Expected a single remove error, got: %#v", errs)
+	}
+	if networks := swarm.Networks(); len(networks) > 0 {
+		t.Errorf("A secret failure stopped the network from being removed: %#v", networks)
+	}
+}
+
+func TestRunRemoveDoesNotWaitForServicesThatWereNotRemoved(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	labels := docker_cli_compose_convert.AddStackLabel(namespace, nil)
+
+	created, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, "web", "nginx"), docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swarm.AddTask(docker_api_types_swarm.Task{
+		ServiceID:   created.ID,
+		Annotations: docker_api_types_swarm.Annotations{Labels: labels},
+		Status:      docker_api_types_swarm.TaskStatus{State: docker_api_types_swarm.TaskStateRunning},
+	})
+	if _, err := swarm.NetworkCreate(ctx, "test_default", docker_api_types.NetworkCreate{Driver: "overlay", Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	swarm.FailOn(fakeswarm.METHOD_SERVICE_REMOVE, errors.New("service is locked"))
+
+	// the task of the service that failed to be removed keeps running, which would block until the timeout
+	opts := removeOptions{namespace: "test", taskWaitTimeout: time.Minute, parallelism: defaultParallelism}
+	started := time.Now()
+	errs := runRemove(ctx, swarm, &recordingEventSink{}, opts)
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("Removing the stack waited %s on the tasks of a service that was not removed", elapsed)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("Expected only the service remove error, got: %#v", errs)
+	}
+	if networks := swarm.Networks(); len(networks) > 0 {
+		t.Errorf("The network removal was not tried after the service failure: %#v", networks)
+	}
+}
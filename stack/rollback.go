@@ -0,0 +1,265 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+/**
+ * A deploy records every service that it creates or updates, so that if
+ * the deploy or the convergence of the stack fails, updated services can
+ * be put back on their previous spec and created services removed.
+ *
+ * Networks and secrets are left in place, as the previous services may
+ * still use them, and pruned services are not recreated.
+ */
+
+const (
+	PROPERTY_ID_STACK_ROLLBACKREPORT = "stack.rollbackreport"
+)
+
+// RollbackReport lists what was rolled back after a failed deploy
+type RollbackReport struct {
+	Namespace string           `json:"namespace"`
+	Changes   []RollbackChange `json:"changes"`
+}
+
+// RollbackChange is a single service that was rolled back, and why the rollback failed if it did
+type RollbackChange struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// deployJournal records the services changed by a deploy, and is safe for concurrent use.
+//
+// Services deployed in parallel finish in any order, so each batch is
+// sorted by name once it is done, to keep rollbacks deterministic.
+type deployJournal struct {
+	lock           sync.Mutex
+	entries        []deployJournalEntry
+	batchStart     int
+	lastBatchStart int
+}
+
+type deployJournalEntry struct {
+	name     string
+	id       string
+	created  bool
+	previous docker_api_types_swarm.ServiceSpec
+}
+
+func (dj *deployJournal) recordCreate(name, id string) {
+	if dj == nil {
+		return
+	}
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	dj.entries = append(dj.entries, deployJournalEntry{name: name, id: id, created: true})
+}
+
+func (dj *deployJournal) recordUpdate(name, id string, previous docker_api_types_swarm.ServiceSpec) {
+	if dj == nil {
+		return
+	}
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	dj.entries = append(dj.entries, deployJournalEntry{name: name, id: id, previous: previous})
+}
+
+// endBatch sorts the entries recorded since the previous batch ended
+func (dj *deployJournal) endBatch() {
+	if dj == nil {
+		return
+	}
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	batch := dj.entries[dj.batchStart:]
+	sort.Slice(batch, func(i, j int) bool { return batch[i].name < batch[j].name })
+	dj.lastBatchStart = dj.batchStart
+	dj.batchStart = len(dj.entries)
+}
+
+// lastBatch lists the names of the services changed in the batch that ended last
+func (dj *deployJournal) lastBatch() map[string]bool {
+	names := map[string]bool{}
+	if dj == nil {
+		return names
+	}
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	for index := dj.lastBatchStart; index < dj.batchStart; index++ {
+		names[dj.entries[index].name] = true
+	}
+	return names
+}
+
+// deployServicesWithRollback deploys and converges services, rolling back the services that were changed if either fails
+func deployServicesWithRollback(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	services map[string]docker_api_types_swarm.ServiceSpec,
+	dependencies map[string][]string,
+	namespace docker_cli_compose_convert.Namespace,
+	registryAuth registryAuthFunc,
+	opts deployOptions,
+) (*RollbackReport, error) {
+	journal := &deployJournal{}
+
+	// the swarm timestamps updates with the daemon clock, which the convergence is checked against
+	var since time.Time
+	if opts.wait {
+		daemonTime, err := getDaemonTime(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		since = daemonTime
+	}
+	err := deployServicesInOrder(ctx, client, events, services, dependencies, namespace, registryAuth, journal, opts)
+	if err == nil && opts.wait {
+		err = waitForConvergence(ctx, client, events, namespace, services, since, opts.waitTimeout)
+	}
+	if err == nil || !opts.rollback || len(journal.entries) == 0 {
+		return nil, err
+	}
+
+	return rollbackServices(ctx, client, events, namespace, journal, opts.sendRegistryAuth, registryAuth), err
+}
+
+// rollbackServices undoes the journalled service changes, newest first
+func rollbackServices(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	namespace docker_cli_compose_convert.Namespace,
+	journal *deployJournal,
+	sendAuth bool,
+	registryAuth registryAuthFunc,
+) *RollbackReport {
+	report := &RollbackReport{Namespace: namespace.Name(), Changes: []RollbackChange{}}
+
+	// updates need the current version of each service
+	current := map[string]docker_api_types_swarm.Service{}
+	services, listErr := getStackServices(ctx, client, namespace.Name())
+	if listErr != nil {
+		reportResourceError(events, RESOURCE_KIND_SERVICE, namespace.Name(), RESOURCE_ACTION_LIST, listErr)
+	}
+	for _, service := range services {
+		current[service.ID] = service
+	}
+
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+
+		change := RollbackChange{Kind: RESOURCE_KIND_SERVICE, Name: entry.name, Action: RESOURCE_ACTION_ROLLBACK}
+		if entry.created {
+			change.Action = RESOURCE_ACTION_REMOVE
+		}
+
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: entry.name, Action: change.Action, Status: EVENT_STATUS_STARTED})
+		var err error
+		if entry.created {
+			err = client.ServiceRemove(ctx, entry.id)
+		} else {
+			err = rollbackServiceUpdate(ctx, client, entry, current, listErr, sendAuth, registryAuth)
+		}
+		if err != nil {
+			change.Error = reportResourceError(events, RESOURCE_KIND_SERVICE, entry.name, change.Action, err).Error()
+		} else {
+			events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: entry.name, Action: change.Action, Status: EVENT_STATUS_SUCCEEDED})
+		}
+
+		report.Changes = append(report.Changes, change)
+	}
+
+	return report
+}
+
+func rollbackServiceUpdate(
+	ctx context.Context,
+	client StackClient,
+	entry deployJournalEntry,
+	current map[string]docker_api_types_swarm.Service,
+	listErr error,
+	sendAuth bool,
+	registryAuth registryAuthFunc,
+) error {
+	if listErr != nil {
+		return listErr
+	}
+	service, exists := current[entry.id]
+	if !exists {
+		return fmt.Errorf("The service no longer exists")
+	}
+
+	updateOpts := docker_api_types.ServiceUpdateOptions{}
+	if sendAuth {
+		encodedAuth, err := registryAuth(ctx, entry.previous.TaskTemplate.ContainerSpec.Image)
+		if err != nil {
+			return err
+		}
+		updateOpts.EncodedRegistryAuth = encodedAuth
+	}
+
+	_, err := client.ServiceUpdate(ctx, entry.id, service.Version, entry.previous, updateOpts)
+	return err
+}
+
+// RollbackReportProperty holds the report of a rollback after a failed deploy
+type RollbackReportProperty struct {
+	val *RollbackReport
+}
+
+func (rrp *RollbackReportProperty) Property() api.Property {
+	return api.Property(rrp)
+}
+
+func (rrp *RollbackReportProperty) Id() string {
+	return PROPERTY_ID_STACK_ROLLBACKREPORT
+}
+
+func (rrp *RollbackReportProperty) Type() string {
+	return "*stack.RollbackReport"
+}
+
+func (rrp *RollbackReportProperty) Ui() api.Ui {
+	return base.NewUi(
+		rrp.Id(),
+		"Stack rollback report",
+		"Services that were rolled back after the deploy failed",
+		"",
+	)
+}
+
+func (rrp *RollbackReportProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (rrp *RollbackReportProperty) Validate() bool {
+	return rrp.val != nil
+}
+
+func (rrp *RollbackReportProperty) Get() interface{} {
+	return interface{}(rrp.val)
+}
+
+func (rrp *RollbackReportProperty) Set(val interface{}) error {
+	if typedVal, success := val.(*RollbackReport); success {
+		rrp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("RollbackReportProperty expects a *RollbackReport value")
+	}
+}
@@ -0,0 +1,106 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func TestDeployRollsBackUpdatedServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	opts := newDeployOptionsForProject("")
+	opts.namespace = "test"
+
+	if _, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, "api", "api:1"), docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	swarm.FailOn(fakeswarm.METHOD_SERVICE_CREATE, errors.New("no capacity"))
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"api":    testServiceSpec(namespace, "api", "api:2"),
+		"worker": testServiceSpec(namespace, "worker", "worker:2"),
+	}
+	report, err := deployServicesWithRollback(ctx, swarm, events, services, nil, namespace, noRegistryAuth, opts)
+	if err == nil {
+		t.Fatal("A failed service create was not reported")
+	}
+	if report == nil || len(report.Changes) != 1 {
+		t.Fatalf("Expected a rollback of a single service, got: %#v", report)
+	}
+	if change := report.Changes[0]; change.Name != "test_api" || change.Action != RESOURCE_ACTION_ROLLBACK || change.Error != "" {
+		t.Errorf("Rollback does not describe the rolled back update: %#v", change)
+	}
+
+	service, _ := swarm.Service("test_api")
+	if image := service.Spec.TaskTemplate.ContainerSpec.Image; image != "api:1" {
+		t.Errorf("Expected service test_api to be back on image api:1, got %s", image)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_api", RESOURCE_ACTION_ROLLBACK, EVENT_STATUS_SUCCEEDED) {
+		t.Error("No rollback event was emitted for service test_api")
+	}
+}
+
+func TestDeployRemovesCreatedServicesWhenConvergenceFails(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	events := &recordingEventSink{}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	opts := newDeployOptionsForProject("")
+	opts.namespace = "test"
+	opts.wait = true
+	opts.waitTimeout = 50 * time.Millisecond
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"web": testServiceSpec(namespace, "web", "nginx"),
+	}
+	report, err := deployServicesWithRollback(context.Background(), swarm, events, services, nil, namespace, noRegistryAuth, opts)
+	if err == nil {
+		t.Fatal("A service without running tasks was reported as converged")
+	}
+	if report == nil || len(report.Changes) != 1 || report.Changes[0].Action != RESOURCE_ACTION_REMOVE {
+		t.Fatalf("Expected the created service to be removed, got: %#v", report)
+	}
+	if _, exists := swarm.Service("test_web"); exists {
+		t.Error("Created service test_web was not removed")
+	}
+}
+
+func TestDeployWithoutRollbackLeavesServices(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	opts := newDeployOptionsForProject("")
+	opts.namespace = "test"
+	opts.rollback = false
+
+	if _, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, "api", "api:1"), docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	swarm.FailOn(fakeswarm.METHOD_SERVICE_CREATE, errors.New("no capacity"))
+
+	services := map[string]docker_api_types_swarm.ServiceSpec{
+		"api":    testServiceSpec(namespace, "api", "api:2"),
+		"worker": testServiceSpec(namespace, "worker", "worker:2"),
+	}
+	report, err := deployServicesWithRollback(ctx, swarm, &recordingEventSink{}, services, nil, namespace, noRegistryAuth, opts)
+	if err == nil {
+		t.Fatal("A failed service create was not reported")
+	}
+	if report != nil {
+		t.Errorf("Expected no rollback, got: %#v", report)
+	}
+
+	service, _ := swarm.Service("test_api")
+	if image := service.Spec.TaskTemplate.ContainerSpec.Image; image != "api:2" {
+		t.Errorf("Expected service test_api to stay on image api:2, got %s", image)
+	}
+}
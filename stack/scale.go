@@ -0,0 +1,229 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_filters "github.com/docker/docker/api/types/filters"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+/**
+ * Scaling changes only the replica count of stack services, like "docker
+ * service scale", so the rest of each service spec is left as the last
+ * deploy, or any other update, made it.
+ *
+ * A service updated by someone else between reading and updating it is
+ * read again and the update retried, a few times.
+ */
+
+const (
+	scaleConflictRetries = 3
+)
+
+type scaleOptions struct {
+	namespace string
+	scales    []string
+}
+
+// serviceScale is a parsed "service=replicas" pair
+type serviceScale struct {
+	service  string
+	replicas uint64
+}
+
+// newScaleOptionsDefault provides scale options for the stack in the current directory
+func newScaleOptionsDefault() scaleOptions {
+	wd, _ := os.Getwd()
+	return newScaleOptionsForProject(wd)
+}
+
+// newScaleOptionsForProject provides scale options for the stack of a project
+func newScaleOptionsForProject(projectRoot string) scaleOptions {
+	return scaleOptions{
+		namespace: namespaceFromPath(projectRoot),
+		scales:    []string{},
+	}
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts scaleOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	namespaceProp := &NamespaceProperty{}
+	namespaceProp.Set(opts.namespace)
+	props.Add(namespaceProp.Property())
+
+	scalesProp := &ScalesProperty{}
+	scalesProp.Set(opts.scales)
+	props.Add(scalesProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts scaleOptions) withProperties(props api.Properties) scaleOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_NAMESPACE); ok {
+		opts.namespace = val
+	}
+	if val, ok := propertyStrings(props, PROPERTY_ID_STACK_SCALES); ok {
+		opts.scales = val
+	}
+	return opts
+}
+
+// validate checks that the options describe a stack and at least one service to scale
+func (opts scaleOptions) validate() []error {
+	errs := []error{}
+
+	if err := validateNamespace(opts.namespace); err != nil {
+		errs = append(errs, err)
+	}
+	if len(opts.scales) == 0 {
+		errs = append(errs, fmt.Errorf("No services to scale, expected service=replicas pairs"))
+	}
+	if _, err := opts.serviceScales(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// serviceScales parses the "service=replicas" pairs, sorted by service
+func (opts scaleOptions) serviceScales() ([]serviceScale, error) {
+	scales := []serviceScale{}
+	seen := map[string]bool{}
+	for _, pair := range opts.scales {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid scale %q, expected service=replicas", pair)
+		}
+		replicas, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid replicas for service %s: %s", parts[0], parts[1])
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("Service %s is scaled more than once", parts[0])
+		}
+		seen[parts[0]] = true
+		scales = append(scales, serviceScale{service: parts[0], replicas: replicas})
+	}
+	sort.Slice(scales, func(i, j int) bool { return scales[i].service < scales[j].service })
+	return scales, nil
+}
+
+// runScale sets the replicas of stack services; nothing is scaled unless every service can be
+func runScale(ctx context.Context, client StackClient, events EventSink, opts scaleOptions) error {
+	scales, err := opts.serviceScales()
+	if err != nil {
+		return err
+	}
+	namespace := docker_cli_compose_convert.NewNamespace(opts.namespace)
+
+	services, err := getStackServices(ctx, client, opts.namespace)
+	if err != nil {
+		return reportResourceError(events, RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	existing := map[string]docker_api_types_swarm.Service{}
+	for _, service := range services {
+		existing[service.Spec.Name] = service
+	}
+
+	errs := []error{}
+	for _, scale := range scales {
+		name := namespace.Scope(scale.service)
+		service, found := existing[name]
+		if !found {
+			errs = append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_SCALE, fmt.Errorf("The service is not part of stack %s", opts.namespace)))
+		} else if err := validateScalable(service); err != nil {
+			errs = append(errs, reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_SCALE, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errorsOrNil(errs)
+	}
+
+	for _, scale := range scales {
+		name := namespace.Scope(scale.service)
+		if err := scaleService(ctx, client, events, existing[name], scale.replicas); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errorsOrNil(errs)
+}
+
+// validateScalable checks that a service runs a set number of replicas, as global services run a task on every node
+func validateScalable(service docker_api_types_swarm.Service) error {
+	if service.Spec.Mode.Replicated == nil {
+		return fmt.Errorf("Only services in replicated mode can be scaled")
+	}
+	return nil
+}
+
+// scaleService updates the replicas of a service, reading the service again if it was updated by someone else in the meantime
+func scaleService(ctx context.Context, client StackClient, events EventSink, service docker_api_types_swarm.Service, replicas uint64) error {
+	name := service.Spec.Name
+	message := fmt.Sprintf("replicas: %d", replicas)
+
+	if current := service.Spec.Mode.Replicated.Replicas; current != nil && *current == replicas {
+		events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_SCALE, Status: EVENT_STATUS_UNCHANGED, Message: message})
+		return nil
+	}
+
+	events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_SCALE, Status: EVENT_STATUS_STARTED, Message: message})
+	for attempt := 0; ; attempt++ {
+		spec := service.Spec
+		replicated := *spec.Mode.Replicated
+		replicated.Replicas = &replicas
+		spec.Mode.Replicated = &replicated
+
+		response, err := client.ServiceUpdate(ctx, service.ID, service.Version, spec, docker_api_types.ServiceUpdateOptions{})
+		if err == nil {
+			for _, warning := range response.Warnings {
+				events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_SCALE, Status: EVENT_STATUS_WARNING, Message: warning})
+			}
+			events.Emit(Event{Kind: RESOURCE_KIND_SERVICE, Name: name, Action: RESOURCE_ACTION_SCALE, Status: EVENT_STATUS_SUCCEEDED})
+			return nil
+		}
+		if !isVersionConflict(err) || attempt >= scaleConflictRetries {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_SCALE, err)
+		}
+
+		if service, err = getService(ctx, client, service.ID); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_INSPECT, err)
+		}
+		if err := validateScalable(service); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SERVICE, name, RESOURCE_ACTION_SCALE, err)
+		}
+	}
+}
+
+// getService reads a single service by ID
+func getService(ctx context.Context, client StackClient, id string) (docker_api_types_swarm.Service, error) {
+	filter := docker_api_types_filters.NewArgs()
+	filter.Add("id", id)
+	services, err := client.ServiceList(ctx, docker_api_types.ServiceListOptions{Filters: filter})
+	if err != nil {
+		return docker_api_types_swarm.Service{}, err
+	}
+	for _, service := range services {
+		if service.ID == id {
+			return service, nil
+		}
+	}
+	return docker_api_types_swarm.Service{}, fmt.Errorf("The service no longer exists")
+}
+
+// isVersionConflict recognises the daemon error for an update made with an outdated service version
+func isVersionConflict(err error) bool {
+	return strings.Contains(err.Error(), "update out of sequence")
+}
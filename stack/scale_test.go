@@ -0,0 +1,115 @@
+package stack
+
+import (
+	"context"
+	"testing"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+// conflictingSwarm updates a service behind the back of the first scale, as a concurrent deploy would
+type conflictingSwarm struct {
+	*fakeswarm.Swarm
+	conflicts int
+}
+
+func (cs *conflictingSwarm) ServiceUpdate(ctx context.Context, serviceID string, version docker_api_types_swarm.Version, service docker_api_types_swarm.ServiceSpec, options docker_api_types.ServiceUpdateOptions) (docker_api_types.ServiceUpdateResponse, error) {
+	if cs.conflicts > 0 {
+		cs.conflicts--
+		if _, err := cs.Swarm.ServiceUpdate(ctx, serviceID, version, service, options); err != nil {
+			return docker_api_types.ServiceUpdateResponse{}, err
+		}
+	}
+	return cs.Swarm.ServiceUpdate(ctx, serviceID, version, service, options)
+}
+
+func serviceReplicas(t *testing.T, swarm *fakeswarm.Swarm, name string) uint64 {
+	service, found := swarm.Service(name)
+	if !found {
+		t.Fatalf("Service %s was not found", name)
+	}
+	return *service.Spec.Mode.Replicated.Replicas
+}
+
+func TestRunScaleUpdatesOnlyReplicas(t *testing.T) {
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	createReplicatedService(t, swarm, namespace, "web", 1)
+	createReplicatedService(t, swarm, namespace, "worker", 2)
+
+	events := &recordingEventSink{}
+	opts := newScaleOptionsForProject("test")
+	opts.scales = []string{"web=3", "worker=2"}
+	if err := runScale(context.Background(), swarm, events, opts); err != nil {
+		t.Fatalf("Unexpected scale error: %s", err)
+	}
+
+	if replicas := serviceReplicas(t, swarm, "test_web"); replicas != 3 {
+		t.Errorf("Expected test_web to run 3 replicas, got %d", replicas)
+	}
+	web, _ := swarm.Service("test_web")
+	if web.Spec.TaskTemplate.ContainerSpec.Image != "nginx" || web.Spec.Labels[docker_cli_compose_convert.LabelNamespace] != "test" {
+		t.Errorf("The rest of the service spec was changed: %#v", web.Spec)
+	}
+	if !events.find(RESOURCE_KIND_SERVICE, "test_worker", RESOURCE_ACTION_SCALE, EVENT_STATUS_UNCHANGED) {
+		t.Error("The unchanged worker service was not reported")
+	}
+}
+
+func TestRunScaleRejectsServicesThatCannotBeScaled(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	createReplicatedService(t, swarm, namespace, "web", 1)
+	agent := testServiceSpec(namespace, "agent", "agent")
+	agent.Mode = docker_api_types_swarm.ServiceMode{Global: &docker_api_types_swarm.GlobalService{}}
+	if _, err := swarm.ServiceCreate(ctx, agent, docker_api_types.ServiceCreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := newScaleOptionsForProject("test")
+	opts.scales = []string{"web=2", "agent=2", "cache=2"}
+	err := runScale(ctx, swarm, &recordingEventSink{}, opts)
+	if errs, ok := err.(StackErrors); !ok || len(errs) != 2 {
+		t.Fatalf("Expected the global and the missing service to be rejected, got: %v", err)
+	}
+	if replicas := serviceReplicas(t, swarm, "test_web"); replicas != 1 {
+		t.Errorf("A service was scaled although others could not be: %d replicas", replicas)
+	}
+}
+
+func TestRunScaleRetriesVersionConflicts(t *testing.T) {
+	swarm := &conflictingSwarm{Swarm: fakeswarm.NewSwarm(), conflicts: 1}
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	createReplicatedService(t, swarm.Swarm, namespace, "web", 1)
+
+	opts := newScaleOptionsForProject("test")
+	opts.scales = []string{"web=5"}
+	if err := runScale(context.Background(), swarm, &recordingEventSink{}, opts); err != nil {
+		t.Fatalf("Unexpected scale error: %s", err)
+	}
+
+	if replicas := serviceReplicas(t, swarm.Swarm, "test_web"); replicas != 5 {
+		t.Errorf("Expected test_web to run 5 replicas, got %d", replicas)
+	}
+}
+
+func TestScaleOptionsRejectInvalidPairs(t *testing.T) {
+	for _, scale := range []string{"web", "=2", "web=-1", "web=many"} {
+		opts := newScaleOptionsForProject("test")
+		opts.scales = []string{scale}
+		if errs := opts.validate(); len(errs) == 0 {
+			t.Errorf("The scale %q was accepted", scale)
+		}
+	}
+
+	opts := newScaleOptionsForProject("test")
+	opts.scales = []string{"web=1", "web=2"}
+	if errs := opts.validate(); len(errs) == 0 {
+		t.Error("A service scaled twice was accepted")
+	}
+}
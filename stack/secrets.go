@@ -0,0 +1,156 @@
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+)
+
+/**
+ * Swarm only allows the labels of a secret to be changed, so each stack
+ * secret is created under its stack name suffixed with a hash of its
+ * content. Changed content creates a new secret version, which services
+ * move to when they are updated, and the stack name is kept in a label.
+ *
+ * Old versions are removed once no service uses them. A version that is
+ * still in the previous spec of a service is kept, so that swarm can still
+ * roll the service back.
+ */
+
+const (
+	LABEL_SECRET_NAME = "com.coachapplication.stack.secret"
+	secretHashLength  = 12
+)
+
+// versionSecrets names each secret after a hash of its content, and labels it with its stack name
+func versionSecrets(secrets []docker_api_types_swarm.SecretSpec) []docker_api_types_swarm.SecretSpec {
+	versioned := []docker_api_types_swarm.SecretSpec{}
+	for _, spec := range secrets {
+		labels := map[string]string{}
+		for key, value := range spec.Labels {
+			labels[key] = value
+		}
+		labels[LABEL_SECRET_NAME] = spec.Name
+		spec.Labels = labels
+
+		hash := sha256.Sum256(spec.Data)
+		spec.Name = spec.Name + "_" + hex.EncodeToString(hash[:])[:secretHashLength]
+
+		versioned = append(versioned, spec)
+	}
+	return versioned
+}
+
+// secretVersionNames maps the stack name of each versioned secret to its versioned name
+func secretVersionNames(secrets []docker_api_types_swarm.SecretSpec) map[string]string {
+	versions := map[string]string{}
+	for _, spec := range secrets {
+		if stackName, found := spec.Labels[LABEL_SECRET_NAME]; found {
+			versions[stackName] = spec.Name
+		}
+	}
+	return versions
+}
+
+// useSecretVersions points the secret references of converted services, which use stack names, at the versioned secrets
+func useSecretVersions(services map[string]docker_api_types_swarm.ServiceSpec, secrets []docker_api_types_swarm.SecretSpec) {
+	versions := secretVersionNames(secrets)
+	for _, service := range services {
+		refs := service.TaskTemplate.ContainerSpec.Secrets
+		for _, ref := range refs {
+			if name, found := versions[ref.SecretName]; found {
+				ref.SecretName = name
+			}
+		}
+		// the converter lists references in map order, which would make every deploy look like a change
+		sort.Slice(refs, func(i, j int) bool { return refs[i].SecretName < refs[j].SecretName })
+	}
+}
+
+// removeUnusedSecretVersions removes the old versions of the stack secrets that no service uses any more
+func removeUnusedSecretVersions(
+	ctx context.Context,
+	client StackClient,
+	events EventSink,
+	namespace docker_cli_compose_convert.Namespace,
+	secrets []docker_api_types_swarm.SecretSpec,
+	parallelism int,
+) []error {
+	stackSecrets, err := getStackSecrets(ctx, client, namespace.Name())
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_LIST, err)}
+	}
+	used, err := getUsedSecrets(ctx, client)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_PRUNE, fmt.Errorf("Could not list the services that use the secrets: %s", err))}
+	}
+
+	unused := selectUnusedSecretVersions(stackSecrets, secrets, used)
+	return runParallel(len(unused), parallelism, events, func(i int, events EventSink) error {
+		secret := unused[i]
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_STARTED, Message: "unused version of " + secret.Spec.Labels[LABEL_SECRET_NAME]})
+		if err := client.SecretRemove(ctx, secret.ID); err != nil {
+			return reportResourceError(events, RESOURCE_KIND_SECRET, secret.Spec.Name, RESOURCE_ACTION_REMOVE, err)
+		}
+		events.Emit(Event{Kind: RESOURCE_KIND_SECRET, Name: secret.Spec.Name, Action: RESOURCE_ACTION_REMOVE, Status: EVENT_STATUS_SUCCEEDED})
+		return nil
+	})
+}
+
+// selectUnusedSecretVersions picks the old versions of the stack secrets that no service uses any more, sorted by name
+func selectUnusedSecretVersions(stackSecrets []docker_api_types_swarm.Secret, secrets []docker_api_types_swarm.SecretSpec, used map[string]bool) []docker_api_types_swarm.Secret {
+	versions := secretVersionNames(secrets)
+
+	unused := []docker_api_types_swarm.Secret{}
+	for _, secret := range stackSecrets {
+		stackName, versioned := secret.Spec.Labels[LABEL_SECRET_NAME]
+		current, found := versions[stackName]
+		if !versioned || !found || current == secret.Spec.Name || used[secret.ID] || used[secret.Spec.Name] {
+			continue
+		}
+		unused = append(unused, secret)
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].Spec.Name < unused[j].Spec.Name })
+	return unused
+}
+
+// pruneSecrets removes stack secrets that are no longer referenced in the source, unless a service still uses them
+func pruneSecrets(ctx context.Context, client StackClient, events EventSink, namespace docker_cli_compose_convert.Namespace, secrets []docker_api_types_swarm.SecretSpec) []error {
+	oldSecrets, err := getStackSecrets(ctx, client, namespace.Name())
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_LIST, err)}
+	}
+	used, err := getUsedSecrets(ctx, client)
+	if err != nil {
+		return []error{reportResourceError(events, RESOURCE_KIND_SECRET, namespace.Name(), RESOURCE_ACTION_PRUNE, fmt.Errorf("Could not list the services that use the secrets: %s", err))}
+	}
+
+	return removeSecrets(ctx, client, events, selectPrunedSecrets(oldSecrets, secrets, used))
+}
+
+// selectPrunedSecrets picks the stack secrets that are no longer referenced in the source and that no service uses, sorted by name
+func selectPrunedSecrets(oldSecrets []docker_api_types_swarm.Secret, secrets []docker_api_types_swarm.SecretSpec, used map[string]bool) []docker_api_types_swarm.Secret {
+	versions := secretVersionNames(secrets)
+
+	// every version of a secret that is still in the source is left to removeUnusedSecretVersions
+	pruneSecrets := []docker_api_types_swarm.Secret{}
+	for _, secret := range oldSecrets {
+		if _, exists := versions[secret.Spec.Labels[LABEL_SECRET_NAME]]; exists || used[secret.ID] || used[secret.Spec.Name] {
+			continue
+		}
+		pruneSecrets = append(pruneSecrets, secret)
+	}
+	sort.Slice(pruneSecrets, func(i, j int) bool { return pruneSecrets[i].Spec.Name < pruneSecrets[j].Spec.Name })
+	return pruneSecrets
+}
+
+// getUsedSecrets collects the secrets that any service uses, or would use if swarm rolled it back
+func getUsedSecrets(ctx context.Context, client StackClient) (map[string]bool, error) {
+	usage, err := getUsage(ctx, client)
+	return usage.secrets, err
+}
@@ -0,0 +1,94 @@
+package stack
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+// testSecretVersion provides the name that a secret with some content is versioned as
+func testSecretVersion(name, data string) string {
+	return versionSecrets([]docker_api_types_swarm.SecretSpec{
+		{Annotations: docker_api_types_swarm.Annotations{Name: name}, Data: []byte(data)},
+	})[0].Name
+}
+
+func TestVersionSecretsHashesContent(t *testing.T) {
+	spec := docker_api_types_swarm.SecretSpec{
+		Annotations: docker_api_types_swarm.Annotations{Name: "test_token", Labels: map[string]string{"tier": "back"}},
+		Data:        []byte("s3cret"),
+	}
+	versioned := versionSecrets([]docker_api_types_swarm.SecretSpec{spec})[0]
+
+	if versioned.Name == spec.Name || versioned.Name != testSecretVersion("test_token", "s3cret") {
+		t.Errorf("Unexpected version name %s", versioned.Name)
+	}
+	if versioned.Name == testSecretVersion("test_token", "n3w") {
+		t.Error("Different content was given the same version name")
+	}
+	if versioned.Labels[LABEL_SECRET_NAME] != "test_token" || versioned.Labels["tier"] != "back" {
+		t.Errorf("Unexpected version labels: %#v", versioned.Labels)
+	}
+	if _, found := spec.Labels[LABEL_SECRET_NAME]; found {
+		t.Error("The original secret labels were changed")
+	}
+}
+
+func TestRunDeployRotatesSecrets(t *testing.T) {
+	dir := writeComposefile(t, `
+version: "3.1"
+services:
+  web:
+    image: nginx
+    secrets:
+      - token
+secrets:
+  token:
+    file: ./token.txt
+`)
+	defer os.RemoveAll(dir)
+
+	swarm := fakeswarm.NewSwarm()
+	opts := newDeployOptionsForProject(dir)
+	opts.namespace = "test"
+
+	deploy := func(token string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "token.txt"), []byte(token), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := runDeploy(context.Background(), swarm, &recordingEventSink{}, noRegistryAuth, opts); err != nil {
+			t.Fatalf("Unexpected deploy error: %s", err)
+		}
+	}
+	secretNames := func() map[string]bool {
+		names := map[string]bool{}
+		for _, secret := range swarm.Secrets() {
+			names[secret.Spec.Name] = true
+		}
+		return names
+	}
+
+	deploy("first")
+	deploy("second")
+	// the first version is still in the previous spec of the service
+	if names := secretNames(); len(names) != 2 || !names[testSecretVersion("test_token", "first")] || !names[testSecretVersion("test_token", "second")] {
+		t.Errorf("Expected both secret versions to exist, got: %v", names)
+	}
+
+	deploy("third")
+	if names := secretNames(); len(names) != 2 || names[testSecretVersion("test_token", "first")] {
+		t.Errorf("Expected the first secret version to be removed, got: %v", names)
+	}
+
+	service, _ := swarm.Service("test_web")
+	version := testSecretVersion("test_token", "third")
+	if secrets := service.Spec.TaskTemplate.ContainerSpec.Secrets; len(secrets) != 1 || secrets[0].SecretName != version {
+		t.Errorf("Service test_web does not reference secret %s: %#v", version, secrets)
+	}
+}
@@ -0,0 +1,175 @@
+package stack
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+)
+
+/**
+ * The daemon fills in defaults for fields that a converted spec leaves
+ * empty, and resolves network names to IDs, so a spec read back from the
+ * swarm never equals the spec that was sent. Both sides are normalised
+ * before comparing, so that only real changes are seen as updates.
+ *
+ * The daemon also pins the image of a service to the digest that the tag
+ * resolved to when it was deployed. A desired image that is only a tag, such
+ * as nginx:latest, can point to a newer image by now, which can't be known
+ * without asking the registry, so it is always seen as a change and the
+ * update is sent, like docker stack deploy does. The daemon resolves the tag
+ * again, and only restarts the tasks if it now points to a different image.
+ * So a service that did not otherwise change is only skipped if its image is
+ * pinned to a digest, or if the daemon could not resolve its tag.
+ */
+
+// serviceSpecChanges lists the fields that differ between the spec of an existing service and a desired spec
+func serviceSpecChanges(existing, desired docker_api_types_swarm.ServiceSpec, networkIds map[string]string) []FieldDiff {
+	existing = normaliseServiceSpec(existing, networkIds)
+	desired = normaliseServiceSpec(desired, networkIds)
+	return diffSpecs(existing, desired)
+}
+
+// normaliseImage writes an image reference the way the docker CLI shows it, with the default registry left out and the tag filled in
+func normaliseImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+
+	// a pinned image is used as it is, whether it has a tag or not
+	if strings.Contains(image, "@") {
+		return image
+	}
+	name := image
+	if index := strings.LastIndex(name, "/"); index >= 0 {
+		name = name[index+1:]
+	}
+	if !strings.Contains(name, ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+// getNetworkIds maps the name of every network to its ID, so that network attachments can be compared
+func getNetworkIds(ctx context.Context, client StackClient) (map[string]string, error) {
+	networks, err := client.NetworkList(ctx, docker_api_types.NetworkListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	networkIds := map[string]string{}
+	for _, network := range networks {
+		networkIds[network.Name] = network.ID
+	}
+	return networkIds, nil
+}
+
+// normaliseServiceSpec provides a copy of a spec with the daemon defaults filled in, leaving the passed spec untouched
+func normaliseServiceSpec(spec docker_api_types_swarm.ServiceSpec, networkIds map[string]string) docker_api_types_swarm.ServiceSpec {
+	if spec.Mode.Global == nil {
+		replicas := uint64(1)
+		if spec.Mode.Replicated != nil && spec.Mode.Replicated.Replicas != nil {
+			replicas = *spec.Mode.Replicated.Replicas
+		}
+		spec.Mode.Replicated = &docker_api_types_swarm.ReplicatedService{Replicas: &replicas}
+	}
+
+	// the deprecated service networks are moved to the task template by the daemon
+	networks := spec.TaskTemplate.Networks
+	if len(networks) == 0 {
+		networks = spec.Networks
+	}
+	spec.Networks = nil
+	spec.TaskTemplate.Networks = normaliseNetworkAttachments(networks, networkIds)
+
+	spec.TaskTemplate = normaliseTaskSpec(spec.TaskTemplate)
+	spec.TaskTemplate.ContainerSpec.Image = normaliseImage(spec.TaskTemplate.ContainerSpec.Image)
+	spec.UpdateConfig = normaliseUpdateConfig(spec.UpdateConfig)
+	spec.RollbackConfig = normaliseUpdateConfig(spec.RollbackConfig)
+	spec.EndpointSpec = normaliseEndpointSpec(spec.EndpointSpec)
+
+	return spec
+}
+
+func normaliseNetworkAttachments(networks []docker_api_types_swarm.NetworkAttachmentConfig, networkIds map[string]string) []docker_api_types_swarm.NetworkAttachmentConfig {
+	normalised := []docker_api_types_swarm.NetworkAttachmentConfig{}
+	for _, network := range networks {
+		if id, found := networkIds[network.Target]; found {
+			network.Target = id
+		}
+		normalised = append(normalised, network)
+	}
+	sort.Slice(normalised, func(i, j int) bool { return normalised[i].Target < normalised[j].Target })
+	return normalised
+}
+
+func normaliseTaskSpec(task docker_api_types_swarm.TaskSpec) docker_api_types_swarm.TaskSpec {
+	resources := docker_api_types_swarm.ResourceRequirements{}
+	if task.Resources != nil {
+		resources = *task.Resources
+	}
+	if resources.Limits == nil {
+		resources.Limits = &docker_api_types_swarm.Resources{}
+	}
+	if resources.Reservations == nil {
+		resources.Reservations = &docker_api_types_swarm.Resources{}
+	}
+	task.Resources = &resources
+
+	restartPolicy := docker_api_types_swarm.RestartPolicy{}
+	if task.RestartPolicy != nil {
+		restartPolicy = *task.RestartPolicy
+	}
+	if restartPolicy.Condition == "" {
+		restartPolicy.Condition = docker_api_types_swarm.RestartPolicyConditionAny
+	}
+	task.RestartPolicy = &restartPolicy
+
+	if task.Placement == nil {
+		task.Placement = &docker_api_types_swarm.Placement{}
+	}
+	if task.ContainerSpec.DNSConfig == nil {
+		task.ContainerSpec.DNSConfig = &docker_api_types_swarm.DNSConfig{}
+	}
+
+	return task
+}
+
+func normaliseUpdateConfig(config *docker_api_types_swarm.UpdateConfig) *docker_api_types_swarm.UpdateConfig {
+	normalised := docker_api_types_swarm.UpdateConfig{}
+	if config != nil {
+		normalised = *config
+	}
+	if normalised.FailureAction == "" {
+		normalised.FailureAction = docker_api_types_swarm.UpdateFailureActionPause
+	}
+	if normalised.Order == "" {
+		normalised.Order = docker_api_types_swarm.UpdateOrderStopFirst
+	}
+	return &normalised
+}
+
+func normaliseEndpointSpec(endpoint *docker_api_types_swarm.EndpointSpec) *docker_api_types_swarm.EndpointSpec {
+	normalised := docker_api_types_swarm.EndpointSpec{}
+	if endpoint != nil {
+		normalised = *endpoint
+	}
+	if normalised.Mode == "" {
+		normalised.Mode = docker_api_types_swarm.ResolutionModeVIP
+	}
+
+	ports := []docker_api_types_swarm.PortConfig{}
+	for _, port := range normalised.Ports {
+		if port.Protocol == "" {
+			port.Protocol = docker_api_types_swarm.PortConfigProtocolTCP
+		}
+		if port.PublishMode == "" {
+			port.PublishMode = docker_api_types_swarm.PortConfigPublishModeIngress
+		}
+		ports = append(ports, port)
+	}
+	normalised.Ports = ports
+
+	return &normalised
+}
@@ -0,0 +1,73 @@
+package stack
+
+import (
+	"testing"
+
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+)
+
+func TestServiceSpecChangesIgnoresDaemonDefaults(t *testing.T) {
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	networkIds := map[string]string{"test_default": "network1"}
+
+	desired := testServiceSpec(namespace, "web", "nginx")
+	desired.Networks = []docker_api_types_swarm.NetworkAttachmentConfig{{Target: "test_default", Aliases: []string{"web"}}}
+	desired.EndpointSpec = &docker_api_types_swarm.EndpointSpec{
+		Ports: []docker_api_types_swarm.PortConfig{{TargetPort: 80, PublishedPort: 8080}},
+	}
+
+	// the spec as the daemon returns it for the desired spec
+	replicas := uint64(1)
+	existing := testServiceSpec(namespace, "web", "nginx")
+	existing.Mode.Replicated = &docker_api_types_swarm.ReplicatedService{Replicas: &replicas}
+	existing.TaskTemplate.Networks = []docker_api_types_swarm.NetworkAttachmentConfig{{Target: "network1", Aliases: []string{"web"}}}
+	existing.TaskTemplate.Resources = &docker_api_types_swarm.ResourceRequirements{}
+	existing.TaskTemplate.Placement = &docker_api_types_swarm.Placement{}
+	existing.UpdateConfig = &docker_api_types_swarm.UpdateConfig{FailureAction: docker_api_types_swarm.UpdateFailureActionPause}
+	existing.EndpointSpec = &docker_api_types_swarm.EndpointSpec{
+		Mode: docker_api_types_swarm.ResolutionModeVIP,
+		Ports: []docker_api_types_swarm.PortConfig{{
+			Protocol:      docker_api_types_swarm.PortConfigProtocolTCP,
+			TargetPort:    80,
+			PublishedPort: 8080,
+			PublishMode:   docker_api_types_swarm.PortConfigPublishModeIngress,
+		}},
+	}
+
+	if diff := serviceSpecChanges(existing, desired, networkIds); len(diff) > 0 {
+		t.Errorf("Daemon defaults were seen as changes: %v", diff)
+	}
+
+	desired.TaskTemplate.ContainerSpec.Image = "nginx:1.13"
+	diff := serviceSpecChanges(existing, desired, networkIds)
+	if len(diff) != 1 || diff[0].Field != "TaskTemplate.ContainerSpec.Image" {
+		t.Errorf("Expected only the image to change: %v", diff)
+	}
+	if desired.Mode.Replicated != nil || desired.EndpointSpec.Mode != "" {
+		t.Error("Normalising changed the desired spec")
+	}
+}
+
+func TestServiceSpecChangesComparesPinnedImages(t *testing.T) {
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	existing := testServiceSpec(namespace, "web", "nginx:latest@"+digest)
+	for _, image := range []string{"nginx:latest@" + digest, "docker.io/library/nginx:latest@" + digest} {
+		desired := testServiceSpec(namespace, "web", image)
+		if diff := serviceSpecChanges(existing, desired, map[string]string{}); len(diff) > 0 {
+			t.Errorf("The same pinned image was seen as a change for image %s: %v", image, diff)
+		}
+	}
+
+	// a tag may point to a newer image than the one the daemon pinned, so it is always updated
+	changed := []string{"nginx", "nginx:latest", "nginx:1.13", "nginx@sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"}
+	for _, image := range changed {
+		desired := testServiceSpec(namespace, "web", image)
+		diff := serviceSpecChanges(existing, desired, map[string]string{})
+		if len(diff) != 1 || diff[0].Field != "TaskTemplate.ContainerSpec.Image" {
+			t.Errorf("Expected only the image to change for image %s: %v", image, diff)
+		}
+	}
+}
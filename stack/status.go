@@ -0,0 +1,410 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_filters "github.com/docker/docker/api/types/filters"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_opts "github.com/docker/docker/opts"
+
+	api "github.com/CoachApplication/api"
+	base "github.com/CoachApplication/base"
+)
+
+/**
+ * The status of a stack combines "docker stack services" and "docker stack
+ * ps": its services with their replicas, and its tasks with where and how
+ * they run. Filters narrow both, but each filter is only passed on to the
+ * listings that accept it; replica counts always cover every stack task.
+ *
+ * The id and name filters select services, so tasks are narrowed to the
+ * tasks of the selected services, through a service filter.
+ */
+
+const (
+	PROPERTY_ID_STACK_STATUS = "stack.status"
+)
+
+var (
+	serviceStatusFilters = map[string]bool{"id": true, "name": true, "label": true, "mode": true}
+	taskStatusFilters    = map[string]bool{"label": true, "desired-state": true, "node": true, "service": true}
+)
+
+type statusOptions struct {
+	namespace string
+	filters   []string
+}
+
+// newStatusOptionsDefault provides status options for the stack in the current directory
+func newStatusOptionsDefault() statusOptions {
+	wd, _ := os.Getwd()
+	return newStatusOptionsForProject(wd)
+}
+
+// newStatusOptionsForProject provides status options for the stack of a project
+func newStatusOptionsForProject(projectRoot string) statusOptions {
+	return statusOptions{
+		namespace: namespaceFromPath(projectRoot),
+	}
+}
+
+// Properties converts the options to Coach properties, which can be used as operation defaults
+func (opts statusOptions) Properties() api.Properties {
+	props := base.NewProperties()
+
+	namespaceProp := &NamespaceProperty{}
+	namespaceProp.Set(opts.namespace)
+	props.Add(namespaceProp.Property())
+
+	filtersProp := &FiltersProperty{}
+	filtersProp.Set(opts.filters)
+	props.Add(filtersProp.Property())
+
+	return props.Properties()
+}
+
+// withProperties returns a copy of the options, overridden by any values found in the properties
+func (opts statusOptions) withProperties(props api.Properties) statusOptions {
+	if val, ok := propertyString(props, PROPERTY_ID_STACK_NAMESPACE); ok {
+		opts.namespace = val
+	}
+	if val, ok := propertyStrings(props, PROPERTY_ID_STACK_FILTERS); ok {
+		opts.filters = val
+	}
+	return opts
+}
+
+// validate checks that the options describe a stack and usable filters
+func (opts statusOptions) validate() []error {
+	errs := []error{}
+
+	if err := validateNamespace(opts.namespace); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := opts.filterOpt(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// filterOpt parses the "key=value" filters
+func (opts statusOptions) filterOpt() (docker_opts.FilterOpt, error) {
+	filterOpt := docker_opts.NewFilterOpt()
+	for _, filter := range opts.filters {
+		if err := filterOpt.Set(filter); err != nil {
+			return filterOpt, err
+		}
+	}
+
+	accepted := map[string]bool{}
+	for key := range serviceStatusFilters {
+		accepted[key] = true
+	}
+	for key := range taskStatusFilters {
+		accepted[key] = true
+	}
+	if err := filterOpt.Value().Validate(accepted); err != nil {
+		return filterOpt, err
+	}
+	return filterOpt, nil
+}
+
+// StackStatus is the state of the services and tasks of a stack
+type StackStatus struct {
+	Namespace string          `json:"namespace"`
+	Services  []ServiceStatus `json:"services"`
+	Tasks     []TaskStatus    `json:"tasks"`
+}
+
+// ServiceStatus is the state of a stack service, like a row of "docker stack services"
+type ServiceStatus struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Mode          string   `json:"mode"`
+	RunningTasks  int      `json:"runningTasks"`
+	DesiredTasks  int      `json:"desiredTasks"`
+	Image         string   `json:"image"`
+	Ports         []string `json:"ports"`
+	UpdateState   string   `json:"updateState,omitempty"`
+	UpdateMessage string   `json:"updateMessage,omitempty"`
+}
+
+// TaskStatus is the state of a stack task, like a row of "docker stack ps"
+type TaskStatus struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Image          string    `json:"image"`
+	Node           string    `json:"node"`
+	DesiredState   string    `json:"desiredState"`
+	State          string    `json:"state"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	StateChangedAt time.Time `json:"stateChangedAt"`
+}
+
+// runStatus collects the state of the stack services and tasks that match the filters
+func runStatus(ctx context.Context, client StackClient, opts statusOptions) (*StackStatus, error) {
+	filterOpt, err := opts.filterOpt()
+	if err != nil {
+		return nil, err
+	}
+
+	stackServices, err := getStackServices(ctx, client, opts.namespace)
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	stackTasks, err := getStackTasks(ctx, client, opts.namespace)
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	services, err := client.ServiceList(ctx, docker_api_types.ServiceListOptions{Filters: statusFilter(opts.namespace, filterOpt, serviceStatusFilters)})
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	tasks, err := getStatusTasks(ctx, client, opts.namespace, filterOpt, services)
+	if err != nil {
+		return nil, newResourceError(RESOURCE_KIND_SERVICE, opts.namespace, RESOURCE_ACTION_LIST, err)
+	}
+	nodes, err := client.NodeList(ctx, docker_api_types.NodeListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	nodeNames := map[string]string{}
+	downNodes := map[string]bool{}
+	for _, node := range nodes {
+		nodeNames[node.ID] = node.Description.Hostname
+		if node.Status.State == docker_api_types_swarm.NodeStateDown {
+			downNodes[node.ID] = true
+		}
+	}
+
+	serviceNames := map[string]string{}
+	for _, service := range stackServices {
+		serviceNames[service.ID] = service.Spec.Name
+	}
+	counts := serviceTaskCounts(stackServices, stackTasks, downNodes)
+
+	status := &StackStatus{Namespace: opts.namespace, Services: []ServiceStatus{}, Tasks: []TaskStatus{}}
+	for _, service := range services {
+		status.Services = append(status.Services, newServiceStatus(service, counts[service.ID]))
+	}
+	sort.Slice(status.Services, func(i, j int) bool { return status.Services[i].Name < status.Services[j].Name })
+
+	for _, task := range tasks {
+		status.Tasks = append(status.Tasks, newTaskStatus(task, serviceNames[task.ServiceID], nodeNames))
+	}
+	sort.Slice(status.Tasks, func(i, j int) bool {
+		if status.Tasks[i].Name != status.Tasks[j].Name {
+			return status.Tasks[i].Name < status.Tasks[j].Name
+		}
+		// newest first, like docker stack ps
+		return status.Tasks[i].CreatedAt.After(status.Tasks[j].CreatedAt)
+	})
+
+	return status, nil
+}
+
+// getStatusTasks lists the stack tasks that match the filters, where the id and name filters match the services of the tasks
+func getStatusTasks(
+	ctx context.Context,
+	client StackClient,
+	namespace string,
+	filterOpt docker_opts.FilterOpt,
+	services []docker_api_types_swarm.Service,
+) ([]docker_api_types_swarm.Task, error) {
+	filter := statusFilter(namespace, filterOpt, taskStatusFilters)
+	if !filterOpt.Value().Include("id") && !filterOpt.Value().Include("name") {
+		return client.TaskList(ctx, docker_api_types.TaskListOptions{Filters: filter})
+	}
+
+	selected := map[string]bool{}
+	for _, service := range services {
+		selected[service.ID] = true
+	}
+	if len(selected) == 0 {
+		return []docker_api_types_swarm.Task{}, nil
+	}
+	// a service filter given as well would widen the selection, so the tasks are narrowed here instead
+	if !filter.Include("service") {
+		for id := range selected {
+			filter.Add("service", id)
+		}
+	}
+
+	tasks, err := client.TaskList(ctx, docker_api_types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+	selectedTasks := []docker_api_types_swarm.Task{}
+	for _, task := range tasks {
+		if selected[task.ServiceID] {
+			selectedTasks = append(selectedTasks, task)
+		}
+	}
+	return selectedTasks, nil
+}
+
+// statusFilter scopes the filters that a listing accepts to the stack
+func statusFilter(namespace string, filterOpt docker_opts.FilterOpt, accepted map[string]bool) docker_api_types_filters.Args {
+	kept := docker_opts.NewFilterOpt()
+	for key := range accepted {
+		for _, value := range filterOpt.Value().Get(key) {
+			kept.Set(key + "=" + value)
+		}
+	}
+	return getStackFilterFromOpt(namespace, kept)
+}
+
+// taskCounts are the running and desired tasks of a service
+type taskCounts struct {
+	running int
+	desired int
+}
+
+// serviceTaskCounts counts the running and desired tasks of each service, like docker service ls; tasks on nodes that are down don't count as running
+func serviceTaskCounts(services []docker_api_types_swarm.Service, tasks []docker_api_types_swarm.Task, downNodes map[string]bool) map[string]taskCounts {
+	counts := map[string]taskCounts{}
+	global := map[string]bool{}
+	for _, service := range services {
+		// global services want a task on every eligible node, which only shows in their tasks
+		if service.Spec.Mode.Global != nil {
+			global[service.ID] = true
+			counts[service.ID] = taskCounts{}
+			continue
+		}
+		replicas := uint64(1)
+		if replicated := service.Spec.Mode.Replicated; replicated != nil && replicated.Replicas != nil {
+			replicas = *replicated.Replicas
+		}
+		counts[service.ID] = taskCounts{desired: int(replicas)}
+	}
+
+	for _, task := range tasks {
+		count, found := counts[task.ServiceID]
+		if !found || task.DesiredState != docker_api_types_swarm.TaskStateRunning {
+			continue
+		}
+		if global[task.ServiceID] {
+			count.desired++
+		}
+		if task.Status.State == docker_api_types_swarm.TaskStateRunning && !downNodes[task.NodeID] {
+			count.running++
+		}
+		counts[task.ServiceID] = count
+	}
+	return counts
+}
+
+func newServiceStatus(service docker_api_types_swarm.Service, counts taskCounts) ServiceStatus {
+	status := ServiceStatus{
+		ID:           service.ID,
+		Name:         service.Spec.Name,
+		Mode:         "replicated",
+		RunningTasks: counts.running,
+		DesiredTasks: counts.desired,
+		Image:        service.Spec.TaskTemplate.ContainerSpec.Image,
+		Ports:        []string{},
+	}
+	if service.Spec.Mode.Global != nil {
+		status.Mode = "global"
+	}
+	if service.UpdateStatus != nil {
+		status.UpdateState = string(service.UpdateStatus.State)
+		status.UpdateMessage = service.UpdateStatus.Message
+	}
+
+	// the endpoint holds the ports that the swarm assigned, which the spec can leave out
+	ports := service.Endpoint.Ports
+	if len(ports) == 0 && service.Spec.EndpointSpec != nil {
+		ports = service.Spec.EndpointSpec.Ports
+	}
+	for _, port := range ports {
+		if port.PublishedPort == 0 {
+			continue
+		}
+		status.Ports = append(status.Ports, fmt.Sprintf("*:%d->%d/%s", port.PublishedPort, port.TargetPort, port.Protocol))
+	}
+	return status
+}
+
+func newTaskStatus(task docker_api_types_swarm.Task, serviceName string, nodeNames map[string]string) TaskStatus {
+	// global tasks have no slot, so docker names them after their node
+	name := fmt.Sprintf("%s.%d", serviceName, task.Slot)
+	if task.Slot == 0 {
+		name = serviceName + "." + task.NodeID
+	}
+
+	node := nodeNames[task.NodeID]
+	if node == "" {
+		node = task.NodeID
+	}
+
+	return TaskStatus{
+		ID:             task.ID,
+		Name:           name,
+		Image:          task.Spec.ContainerSpec.Image,
+		Node:           node,
+		DesiredState:   string(task.DesiredState),
+		State:          string(task.Status.State),
+		Error:          strings.TrimSpace(task.Status.Err),
+		CreatedAt:      task.CreatedAt,
+		UpdatedAt:      task.UpdatedAt,
+		StateChangedAt: task.Status.Timestamp,
+	}
+}
+
+// StatusProperty holds the state of the stack services and tasks
+type StatusProperty struct {
+	val *StackStatus
+}
+
+func (sp *StatusProperty) Property() api.Property {
+	return api.Property(sp)
+}
+
+func (sp *StatusProperty) Id() string {
+	return PROPERTY_ID_STACK_STATUS
+}
+
+func (sp *StatusProperty) Type() string {
+	return "*stack.StackStatus"
+}
+
+func (sp *StatusProperty) Ui() api.Ui {
+	return base.NewUi(
+		sp.Id(),
+		"Stack status",
+		"Services of the stack with their replicas, and tasks with where and how they run",
+		"",
+	)
+}
+
+func (sp *StatusProperty) Usage() api.Usage {
+	return (&base.ReadonlyPropertyUsage{}).Usage()
+}
+
+func (sp *StatusProperty) Validate() bool {
+	return sp.val != nil
+}
+
+func (sp *StatusProperty) Get() interface{} {
+	return interface{}(sp.val)
+}
+
+func (sp *StatusProperty) Set(val interface{}) error {
+	if typedVal, success := val.(*StackStatus); success {
+		sp.val = typedVal
+		return nil
+	} else {
+		return fmt.Errorf("StatusProperty expects a *StackStatus value")
+	}
+}
@@ -0,0 +1,160 @@
+package stack
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	docker_api_types "github.com/docker/docker/api/types"
+	docker_api_types_swarm "github.com/docker/docker/api/types/swarm"
+	docker_cli_compose_convert "github.com/docker/docker/cli/compose/convert"
+
+	"github.com/CoachApplication/handler-dockercli/stack/fakeswarm"
+)
+
+func TestRunStatusListsServicesAndTasks(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	nodeId := swarm.AddNode(docker_api_types_swarm.Node{Description: docker_api_types_swarm.NodeDescription{Hostname: "worker1"}})
+
+	replicas := uint64(2)
+	spec := testServiceSpec(namespace, "web", "nginx")
+	spec.Mode.Replicated = &docker_api_types_swarm.ReplicatedService{Replicas: &replicas}
+	spec.EndpointSpec = &docker_api_types_swarm.EndpointSpec{Ports: []docker_api_types_swarm.PortConfig{
+		{Protocol: docker_api_types_swarm.PortConfigProtocolTCP, TargetPort: 80, PublishedPort: 8080},
+	}}
+	created, err := swarm.ServiceCreate(ctx, spec, docker_api_types.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slot, state := range []docker_api_types_swarm.TaskState{docker_api_types_swarm.TaskStateRunning, docker_api_types_swarm.TaskStateFailed} {
+		swarm.AddTask(docker_api_types_swarm.Task{
+			Annotations:  docker_api_types_swarm.Annotations{Labels: spec.Labels},
+			Spec:         spec.TaskTemplate,
+			ServiceID:    created.ID,
+			Slot:         slot + 1,
+			NodeID:       nodeId,
+			DesiredState: docker_api_types_swarm.TaskStateRunning,
+			Status:       docker_api_types_swarm.TaskStatus{State: state, Err: "exit code 1"},
+		})
+	}
+
+	opts := newStatusOptionsForProject("")
+	opts.namespace = "test"
+	status, err := runStatus(ctx, swarm, opts)
+	if err != nil {
+		t.Fatalf("Unexpected status error: %s", err)
+	}
+
+	if len(status.Services) != 1 {
+		t.Fatalf("Expected a single service, got: %#v", status.Services)
+	}
+	web := status.Services[0]
+	if web.Name != "test_web" || web.Mode != "replicated" || web.RunningTasks != 1 || web.DesiredTasks != 2 || web.Image != "nginx" {
+		t.Errorf("Unexpected service status: %#v", web)
+	}
+	if !reflect.DeepEqual(web.Ports, []string{"*:8080->80/tcp"}) {
+		t.Errorf("Unexpected service ports: %v", web.Ports)
+	}
+
+	if len(status.Tasks) != 2 {
+		t.Fatalf("Expected two tasks, got: %#v", status.Tasks)
+	}
+	if task := status.Tasks[1]; task.Name != "test_web.2" || task.Node != "worker1" || task.State != "failed" || task.Error != "exit code 1" {
+		t.Errorf("Unexpected task status: %#v", task)
+	}
+}
+
+func TestRunStatusAppliesFilters(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	swarm.SetAutoRunTasks(true)
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	for _, name := range []string{"web", "db"} {
+		if _, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, name, name), docker_api_types.ServiceCreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := newStatusOptionsForProject("")
+	opts.namespace = "test"
+	opts.filters = []string{"name=test_web", "desired-state=shutdown"}
+	status, err := runStatus(ctx, swarm, opts)
+	if err != nil {
+		t.Fatalf("Unexpected status error: %s", err)
+	}
+
+	if len(status.Services) != 1 || status.Services[0].Name != "test_web" {
+		t.Fatalf("Expected only service test_web, got: %#v", status.Services)
+	}
+	// every task is running, so none are left by the desired state filter
+	if len(status.Tasks) != 0 {
+		t.Errorf("Expected no tasks, got: %#v", status.Tasks)
+	}
+	// replica counts are not narrowed by the filters
+	if status.Services[0].RunningTasks != 1 {
+		t.Errorf("Expected the running task of test_web to be counted, got: %#v", status.Services[0])
+	}
+}
+
+func TestRunStatusFiltersTasksByService(t *testing.T) {
+	ctx := context.Background()
+	swarm := fakeswarm.NewSwarm()
+	swarm.SetAutoRunTasks(true)
+	namespace := docker_cli_compose_convert.NewNamespace("test")
+
+	ids := map[string]string{}
+	for _, name := range []string{"web", "db"} {
+		created, err := swarm.ServiceCreate(ctx, testServiceSpec(namespace, name, name), docker_api_types.ServiceCreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = created.ID
+	}
+
+	for _, filter := range []string{"id=" + ids["web"], "name=test_web"} {
+		opts := newStatusOptionsForProject("")
+		opts.namespace = "test"
+		opts.filters = []string{filter}
+		status, err := runStatus(ctx, swarm, opts)
+		if err != nil {
+			t.Fatalf("Unexpected status error for %s: %s", filter, err)
+		}
+
+		if len(status.Services) != 1 || status.Services[0].Name != "test_web" {
+			t.Errorf("Expected only service test_web for %s, got: %#v", filter, status.Services)
+		}
+		if len(status.Tasks) != 1 || status.Tasks[0].Name != "test_web.1" {
+			t.Errorf("Expected only the task of test_web for %s, got: %#v", filter, status.Tasks)
+		}
+	}
+
+	// no service matches, so there are no tasks either
+	opts := newStatusOptionsForProject("")
+	opts.namespace = "test"
+	opts.filters = []string{"name=test_cache"}
+	status, err := runStatus(ctx, swarm, opts)
+	if err != nil {
+		t.Fatalf("Unexpected status error: %s", err)
+	}
+	if len(status.Services) != 0 || len(status.Tasks) != 0 {
+		t.Errorf("Expected no services or tasks, got: %#v", status)
+	}
+}
+
+func TestStatusOptionsRejectUnknownFilters(t *testing.T) {
+	opts := newStatusOptionsForProject("")
+	opts.namespace = "test"
+
+	opts.filters = []string{"colour=blue"}
+	if errs := opts.validate(); len(errs) == 0 {
+		t.Error("An unknown filter was accepted")
+	}
+	opts.filters = []string{"node"}
+	if errs := opts.validate(); len(errs) == 0 {
+		t.Error("A filter without a value was accepted")
+	}
+}